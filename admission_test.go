@@ -0,0 +1,109 @@
+package funnel
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithAdmissionController(t *testing.T) {
+	// Admits executions while fewer than the threshold are in flight.
+	var inFlight, threshold int32 = 0, 2
+	fnl := New(WithAdmissionController(func(operationId string) bool {
+		return atomic.LoadInt32(&inFlight) < atomic.LoadInt32(&threshold)
+	}))
+
+	release := make(chan empty)
+	var started sync.WaitGroup
+	opExeFunc := func() (interface{}, error) {
+		atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		started.Done()
+		<-release
+		return "res", nil
+	}
+
+	var wg sync.WaitGroup
+	started.Add(int(threshold))
+	for i := 0; i < int(threshold); i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			res, err := fnl.Execute(id, opExeFunc)
+			assert.Nil(t, err)
+			assert.Equal(t, "res", res)
+		}(strconv.Itoa(i))
+	}
+	started.Wait()
+
+	_, err := fnl.Execute("rejected", opExeFunc)
+	assert.Equal(t, ErrRejected, err)
+
+	// Joining an operation in process is still allowed.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		res, err := fnl.Execute("0", opExeFunc)
+		assert.Nil(t, err)
+		assert.Equal(t, "res", res)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	// Raising the threshold admits new executions.
+	atomic.StoreInt32(&threshold, 3)
+	started.Add(1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := fnl.Execute("admitted", opExeFunc)
+		assert.Nil(t, err)
+	}()
+	started.Wait()
+
+	close(release)
+	wg.Wait()
+}
+
+// Requests for the same operation racing through the admission controller, which is called without holding the lock,
+// still create a single operation and share its execution.
+func TestAdmissionControllerConcurrentCreation(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		fnl := New(WithAdmissionController(func(operationId string) bool {
+			time.Sleep(time.Millisecond) // Widens the window in which the lock is released.
+			return true
+		}))
+
+		var numOfExecutions int64
+		release := make(chan empty)
+		start := make(chan empty)
+		numOfRequests := 50
+		var wg sync.WaitGroup
+		for i := 0; i < numOfRequests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				res, err := fnl.Execute("opId", func() (interface{}, error) {
+					atomic.AddInt64(&numOfExecutions, 1)
+					<-release
+					return "res", nil
+				})
+				assert.Nil(t, err)
+				assert.Equal(t, "res", res)
+			}()
+		}
+		close(start)
+		assert.Eventually(t, func() bool {
+			return fnl.Dump().Waiters == numOfRequests
+		}, time.Second, time.Millisecond, "all the requests should wait for the same operation")
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int64(1), atomic.LoadInt64(&numOfExecutions))
+		assert.Equal(t, uint64(numOfRequests-1), fnl.Stats().Coalesced)
+	}
+}
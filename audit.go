@@ -0,0 +1,50 @@
+package funnel
+
+import "time"
+
+// AuditRecord describes a single execution of an operation, see WithAuditSink.
+type AuditRecord struct {
+	// The name of the funnel, see WithName.
+	Funnel string
+
+	OperationId string
+
+	// The time at which the operation was started (including any wait for the concurrency budget) and the time at which
+	// its execution returned.
+	Start time.Time
+	End   time.Time
+
+	// The error returned by the execution, nil on success.
+	Err error
+
+	// The value recovered when the execution panicked, nil otherwise.
+	Panic interface{}
+
+	// The number of requests that were served by the execution up to its completion, including the request that started it.
+	// Requests served from the cache after completion are not counted.
+	Served int
+}
+
+// Succeeded reports whether the execution returned without error and without panic.
+func (r AuditRecord) Succeeded() bool {
+	return r.Err == nil && r.Panic == nil
+}
+
+// An AuditSink receives a record of every execution of an operation. The sink is responsible for the durability of the
+// records; it is called synchronously, outside of the funnel's lock, and should return quickly.
+type AuditSink interface {
+	Record(rec AuditRecord)
+}
+
+// auditRecord returns the audit record of the operation. Must be called with the lock held, once the execution returned.
+func (f *Funnel) auditRecord(op *operationInProcess, recovered interface{}) AuditRecord {
+	return AuditRecord{
+		Funnel:      op.config.name,
+		OperationId: op.operationId,
+		Start:       op.startTime,
+		End:         time.Now(),
+		Err:         op.err,
+		Panic:       recovered,
+		Served:      op.served,
+	}
+}
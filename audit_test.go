@@ -0,0 +1,91 @@
+package funnel
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intuit/funnel/internal/schedule"
+	"github.com/stretchr/testify/assert"
+)
+
+// capturingSink keeps the audit records it receives.
+type capturingSink struct {
+	sync.Mutex
+	records []AuditRecord
+}
+
+func (s *capturingSink) Record(rec AuditRecord) {
+	s.Lock()
+	defer s.Unlock()
+	s.records = append(s.records, rec)
+}
+
+func (s *capturingSink) get() []AuditRecord {
+	s.Lock()
+	defer s.Unlock()
+	return append([]AuditRecord(nil), s.records...)
+}
+
+func TestAuditSinkRecordPerExecution(t *testing.T) {
+	sink := &capturingSink{}
+	gate := newPointGate(schedule.BeforeExecute)
+	fnl := New(WithName("audited"), WithCacheTtl(time.Hour), WithAuditSink(sink), gate.option())
+
+	numOfWaiters := 3
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fnl.Execute("ok", func() (interface{}, error) { return "res", nil })
+	}()
+	<-gate.reached
+	for i := 1; i < numOfWaiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fnl.Execute("ok", func() (interface{}, error) { return "res", nil })
+		}()
+	}
+	for served := 0; served < numOfWaiters; {
+		time.Sleep(time.Millisecond)
+		fnl.Lock()
+		served = fnl.opInProcess["ok"].served
+		fnl.Unlock()
+	}
+	before := time.Now()
+	close(gate.release)
+	wg.Wait()
+
+	// Served from the cache, not audited.
+	fnl.Execute("ok", func() (interface{}, error) { return "res", nil })
+
+	opErr := errors.New("operation error")
+	fnl.Execute("err", func() (interface{}, error) { return nil, opErr })
+	assert.Panics(t, func() {
+		fnl.Execute("panic", func() (interface{}, error) { panic("boom") })
+	})
+
+	records := sink.get()
+	if !assert.Len(t, records, 3) {
+		return
+	}
+
+	ok := records[0]
+	assert.Equal(t, "audited", ok.Funnel)
+	assert.Equal(t, "ok", ok.OperationId)
+	assert.True(t, ok.Succeeded())
+	assert.Equal(t, numOfWaiters, ok.Served)
+	assert.True(t, ok.Start.Before(before))
+	assert.False(t, ok.End.Before(before))
+
+	assert.Equal(t, "err", records[1].OperationId)
+	assert.Equal(t, opErr, records[1].Err)
+	assert.False(t, records[1].Succeeded())
+	assert.Equal(t, 1, records[1].Served)
+
+	assert.Equal(t, "panic", records[2].OperationId)
+	assert.Equal(t, "boom", records[2].Panic)
+	assert.False(t, records[2].Succeeded())
+}
@@ -0,0 +1,143 @@
+package funnel
+
+import "sync"
+
+// A Backend broadcasts the invalidations of operations between the funnels sharing it, e.g. the instances of a service
+// caching the same operations (see WithBackend), so that forgetting an operation in one of them forgets it in all.
+// The methods must be safe for concurrent use.
+type Backend interface {
+	// Subscribe returns the channel on which the identifiers of the invalidated operations are received, including the
+	// ones published by the subscriber itself. It's called once by New, and the funnel receives from the channel until
+	// either is closed.
+	Subscribe() <-chan string
+
+	// Unsubscribe ends the subscription, once the funnel that subscribed is closed (see Close). The backend stops
+	// sending on the channel, and may close it.
+	Unsubscribe(subscription <-chan string)
+
+	// PublishInvalidation publishes the invalidation of the operation to all the subscribers. It must not wait for the
+	// subscribers to receive the invalidation, and an implementation that fails to publish reports the failure itself.
+	PublishInvalidation(operationId string)
+}
+
+// LocalBackend is a Backend that broadcasts the invalidations between the funnels of the process sharing it, e.g. for
+// tests. The zero value is ready for use.
+type LocalBackend struct {
+	mu          sync.Mutex
+	subscribers []*localSubscriber
+}
+
+// localSubscriber queues the invalidations published for a subscriber, and delivers them on its channel from a
+// goroutine of its own, so that a slow subscriber doesn't block the publishers.
+type localSubscriber struct {
+	ch chan string
+
+	mu      sync.Mutex
+	pending []string
+
+	// wake is signaled once invalidations are queued, and done is closed once unsubscribed.
+	wake chan empty
+	done chan empty
+}
+
+// Subscribe returns a new subscription to the invalidations, closed once unsubscribed. The invalidations not received
+// yet are queued without bound.
+func (b *LocalBackend) Subscribe() <-chan string {
+	subscriber := &localSubscriber{ch: make(chan string), wake: make(chan empty, 1), done: make(chan empty)}
+	go subscriber.deliver()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, subscriber)
+	return subscriber.ch
+}
+
+// Unsubscribe ends the subscription, dropping the invalidations it didn't receive yet.
+func (b *LocalBackend) Unsubscribe(subscription <-chan string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, subscriber := range b.subscribers {
+		if (<-chan string)(subscriber.ch) == subscription {
+			b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+			close(subscriber.done)
+			return
+		}
+	}
+}
+
+// PublishInvalidation queues the identifier for all the subscribers, without waiting for them to receive it.
+func (b *LocalBackend) PublishInvalidation(operationId string) {
+	b.mu.Lock()
+	subscribers := b.subscribers
+	b.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.mu.Lock()
+		subscriber.pending = append(subscriber.pending, operationId)
+		subscriber.mu.Unlock()
+
+		select {
+		case subscriber.wake <- empty{}:
+		default: // Already signaled.
+		}
+	}
+}
+
+// deliver sends the queued invalidations on the subscriber's channel, until unsubscribed.
+func (s *localSubscriber) deliver() {
+	defer close(s.ch)
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+
+		for {
+			s.mu.Lock()
+			if len(s.pending) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			operationId := s.pending[0]
+			s.pending = s.pending[1:]
+			s.mu.Unlock()
+
+			select {
+			case s.ch <- operationId:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// receiveInvalidations forgets the operations invalidated through the backend, until its channel is closed or the funnel
+// is closed.
+func (f *Funnel) receiveInvalidations(invalidations <-chan string) {
+	for {
+		select {
+		case operationId, ok := <-invalidations:
+			if !ok {
+				return
+			}
+			f.Lock()
+			f.forget(operationId)
+			f.Unlock()
+		case <-f.closed:
+			return
+		}
+	}
+}
+
+// publishInvalidations publishes the invalidation of the operations explicitly forgotten, if the funnel has a backend.
+// Must be called without holding the lock.
+func (f *Funnel) publishInvalidations(operationIds ...string) {
+	if f.backend != nil {
+		for _, operationId := range operationIds {
+			f.backend.PublishInvalidation(operationId)
+		}
+	}
+}
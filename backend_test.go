@@ -0,0 +1,80 @@
+package funnel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendBroadcastsInvalidations(t *testing.T) {
+	backend := &LocalBackend{}
+	fnl1 := New(WithCacheTtl(time.Hour), WithBackend(backend))
+	fnl2 := New(WithCacheTtl(time.Hour), WithBackend(backend))
+	defer fnl1.Close()
+	defer fnl2.Close()
+
+	opExeFunc := func() (interface{}, error) { return "cached", nil }
+	for _, fnl := range []*Funnel{fnl1, fnl2} {
+		fnl.Execute("opId", opExeFunc)
+		fnl.ExecuteWithDeps("derived", []string{"opId"}, opExeFunc)
+		fnl.Execute("unrelated", opExeFunc)
+	}
+
+	fnl1.Forget("opId")
+
+	assert.Eventually(t, func() bool {
+		return !fnl2.IsOpInProgress("opId") && !fnl2.IsOpInProgress("derived")
+	}, time.Second, time.Millisecond, "the invalidation should have been received by the other funnel")
+	assert.True(t, fnl2.IsOpInProgress("unrelated"))
+	assert.False(t, fnl1.IsOpInProgress("derived"))
+	assert.True(t, fnl1.IsOpInProgress("unrelated"))
+}
+
+func TestBackendUnsubscribesClosedFunnel(t *testing.T) {
+	backend := &LocalBackend{}
+	closed := New(WithBackend(backend))
+	fnl := New(WithBackend(backend))
+	defer fnl.Close()
+	closed.Close()
+
+	done := make(chan empty)
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			fnl.Forget("opId")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the closed funnel should not block the publishers")
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	assert.Len(t, backend.subscribers, 1, "the closed funnel should have unsubscribed")
+}
+
+func TestLocalBackendSlowSubscriber(t *testing.T) {
+	backend := &LocalBackend{}
+	subscription := backend.Subscribe()
+
+	for i := 0; i < 1000; i++ {
+		backend.PublishInvalidation("opId")
+	}
+	assert.Equal(t, "opId", <-subscription)
+
+	backend.Unsubscribe(subscription)
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-subscription:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the subscription should be closed once unsubscribed")
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package funnel
+
+import "context"
+
+// A Request is one of the operations requested at once from the funnel, see ExecuteAll.
+type Request struct {
+	OperationId string
+	OpExeFunc   func() (interface{}, error)
+}
+
+// A Response is the outcome of a Request, as returned by ExecuteAll.
+type Response struct {
+	Res interface{}
+	Err error
+}
+
+// ExecuteAll executes all the requests concurrently, each like Execute would, and returns their responses in the order
+// of the requests once all of them are available. Requests for the same operation, in the batch or not, are coalesced
+// as usual. Like Execute, if an operation ended with panic, ExecuteAll panics the same way.
+func (f *Funnel) ExecuteAll(reqs []Request) []Response {
+	return f.ExecuteAllContext(context.Background(), reqs)
+}
+
+// ExecuteAllContext is like ExecuteAll, but the context bounds the wait for the whole batch, e.g. for gathering whatever
+// completed within a deadline: once the context is done, each of the requests that didn't complete yet gets a
+// *CanceledError carrying the context's cause (see Promise.Await), so that errors.Is(err, context.DeadlineExceeded)
+// holds for those that missed the deadline. The operations that didn't complete are not abandoned, they keep executing
+// for the other requests and cache their results as usual.
+func (f *Funnel) ExecuteAllContext(ctx context.Context, reqs []Request) []Response {
+	promises := make([]*Promise, len(reqs))
+	for i, req := range reqs {
+		promises[i] = f.Submit(req.OperationId, req.OpExeFunc)
+	}
+
+	resps := make([]Response, len(reqs))
+	for i, p := range promises {
+		resps[i].Res, resps[i].Err = p.Await(ctx)
+	}
+	return resps
+}
+
+// ExecuteBatch is like ExecuteAll for the operations identified by ids, all executed by the same function given the
+// identifier, e.g. for hydrating several entities at once. Duplicate identifiers are requested once. It returns the
+// results of the operations that succeeded and the errors of the others (including those that timed out) by identifier,
+// once all of them are available.
+func (f *Funnel) ExecuteBatch(ids []string, opExeFunc func(id string) (interface{}, error)) (map[string]interface{}, map[string]error) {
+	reqs := make([]Request, 0, len(ids))
+	requested := make(map[string]empty, len(ids))
+	for _, id := range ids {
+		if _, found := requested[id]; found {
+			continue
+		}
+		requested[id] = empty{}
+		id := id
+		reqs = append(reqs, Request{OperationId: id, OpExeFunc: func() (interface{}, error) { return opExeFunc(id) }})
+	}
+
+	results, errs := make(map[string]interface{}), make(map[string]error)
+	for i, resp := range f.ExecuteAll(reqs) {
+		if resp.Err != nil {
+			errs[reqs[i].OperationId] = resp.Err
+		} else {
+			results[reqs[i].OperationId] = resp.Res
+		}
+	}
+	return results, errs
+}
@@ -0,0 +1,82 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteAll(t *testing.T) {
+	fnl := New()
+
+	opErr := errors.New("failed")
+	numOfExecutions := 0
+	resps := fnl.ExecuteAll([]Request{
+		{"a", func() (interface{}, error) {
+			numOfExecutions++
+			time.Sleep(time.Millisecond * 20)
+			return "a", nil
+		}},
+		{"failed", func() (interface{}, error) { return nil, opErr }},
+		{"a", func() (interface{}, error) { return "duplicate", nil }},
+	})
+	assert.Equal(t, []Response{{"a", nil}, {nil, opErr}, {"a", nil}}, resps)
+	assert.Equal(t, 1, numOfExecutions)
+}
+
+func TestExecuteAllContextPartialResults(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	resps := fnl.ExecuteAllContext(ctx, []Request{
+		{"fast", func() (interface{}, error) { return "fast", nil }},
+		{"slow", func() (interface{}, error) {
+			<-release
+			return "slow", nil
+		}},
+	})
+
+	assert.Equal(t, Response{"fast", nil}, resps[0])
+	assert.Nil(t, resps[1].Res)
+	assert.ErrorIs(t, resps[1].Err, context.DeadlineExceeded)
+
+	// The operation that missed the deadline keeps executing for the other requests.
+	assert.True(t, fnl.IsExecuting("slow"))
+	release <- empty{}
+	res, err := fnl.Execute("slow", nil)
+	assert.Equal(t, "slow", res)
+	assert.Nil(t, err)
+}
+
+func TestExecuteBatch(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond * 50))
+
+	var mu sync.Mutex
+	executions := map[string]int{}
+	opErr := errors.New("failed")
+	results, errs := fnl.ExecuteBatch([]string{"a", "b", "a", "failed", "slow", "b"}, func(id string) (interface{}, error) {
+		mu.Lock()
+		executions[id]++
+		mu.Unlock()
+		switch id {
+		case "failed":
+			return nil, opErr
+		case "slow":
+			time.Sleep(time.Millisecond * 100)
+		}
+		return "res " + id, nil
+	})
+
+	assert.Equal(t, map[string]interface{}{"a": "res a", "b": "res b"}, results)
+	assert.Equal(t, map[string]error{"failed": opErr, "slow": timeoutError}, errs)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"a": 1, "b": 1, "failed": 1, "slow": 1}, executions, "duplicates are executed once")
+}
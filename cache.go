@@ -0,0 +1,158 @@
+package funnel
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A Cache is an external cache of the results of the operations, e.g. one shared by the instances of a service so that
+// a result computed by one instance is served by the others (see WithCache). Unless the cache is a MemoryCache, the
+// values are the encodings of the results with the codec (see WithCodec), as []byte. The funnel still coalesces the requests
+// in process, and holds the results it caches; the external cache is consulted by an execution before executing the
+// operation, and the successful results the funnel caches are written through to it. The methods are called without
+// holding the funnel's lock, and must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value cached for the operation, false when it's not cached.
+	Get(operationId string) (interface{}, bool)
+
+	// Set caches the value of the operation for the time-to-live.
+	Set(operationId string, value interface{}, ttl time.Duration)
+
+	// Delete deletes the value cached for the operation, if any.
+	Delete(operationId string)
+}
+
+// MemoryCache is a Cache that holds the values in the memory of the process, e.g. for sharing the results between the
+// funnels of a process. The results are held as is, without a codec, and deleted once their time-to-live elapsed as they're looked up.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewMemoryCache returns an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+// Get returns the value cached for the operation, unless its time-to-live elapsed.
+func (c *MemoryCache) Get(operationId string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.entries[operationId]
+	if !found {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		delete(c.entries, operationId)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set caches the value of the operation for the time-to-live, replacing the value cached for it, if any.
+func (c *MemoryCache) Set(operationId string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[operationId] = memoryCacheEntry{value: value, expiresAt: time.Now().Add(ttl)}
+}
+
+// Delete deletes the value cached for the operation.
+func (c *MemoryCache) Delete(operationId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, operationId)
+}
+
+// encodesCached reports whether the results are encoded with the codec (see WithCodec) for the cache: the values of an
+// in-memory cache are held as is, and those of any other cache are encoded.
+func (cfg *Config) encodesCached() bool {
+	_, inMemory := cfg.externalCache.(*MemoryCache)
+	return cfg.externalCache != nil && !inMemory
+}
+
+// getCached looks the result of the operation up in the external cache, if any, decoding it when needed. A panic of
+// the cache or of the codec, and a value that can't be decoded, are reported to the internal error handler, as a miss.
+func (f *Funnel) getCached(op *operationInProcess) (res interface{}, ok bool) {
+	c := op.config.externalCache
+	if c == nil {
+		return nil, false
+	}
+	defer func() {
+		if rr := recover(); rr != nil {
+			f.internalError(op.operationId, fmt.Errorf("cache lookup of operation %s panicked: %v", op.operationId, rr))
+			res, ok = nil, false
+		}
+	}()
+	value, ok := c.Get(op.operationId)
+	if !ok || !op.config.encodesCached() {
+		return value, ok
+	}
+	b, isEncoded := value.([]byte)
+	if !isEncoded {
+		f.internalError(op.operationId, fmt.Errorf("cached value of operation %s is a %T rather than an encoding", op.operationId, value))
+		return nil, false
+	}
+	res, err := op.config.decode(b)
+	if err != nil {
+		f.internalError(op.operationId, fmt.Errorf("cached value of operation %s can't be decoded: %w", op.operationId, err))
+		return nil, false
+	}
+	return res, true
+}
+
+// setCached returns the notification writing the result of the operation through to the external cache for the
+// time-to-live, encoded when needed, to make once the lock is released, or nil when the result isn't written: without
+// an external cache, for an error and for a result read from the cache. A panic of the cache or of the codec, and a
+// result that can't be encoded, are reported to the internal error handler.
+func (f *Funnel) setCached(op *operationInProcess, ttl time.Duration) func() {
+	c := op.config.externalCache
+	if c == nil || op.err != nil || op.readThrough {
+		return nil
+	}
+	operationId, res, cfg := op.operationId, op.res, op.config
+	return func() {
+		defer func() {
+			if rr := recover(); rr != nil {
+				f.internalError(operationId, fmt.Errorf("cache write of operation %s panicked: %v", operationId, rr))
+			}
+		}()
+		value := res
+		if cfg.encodesCached() {
+			b, err := cfg.encode(res)
+			if err != nil {
+				f.internalError(operationId, fmt.Errorf("result of operation %s can't be encoded for the cache: %w", operationId, err))
+				return
+			}
+			value = b
+		}
+		c.Set(operationId, value, ttl)
+	}
+}
+
+// deleteCached deletes the results of the forgotten operations from the external cache, if any. Must be called
+// without holding the lock.
+func (f *Funnel) deleteCached(operationIds []string) {
+	c := f.currentConfig().externalCache
+	if c == nil {
+		return
+	}
+	for _, operationId := range operationIds {
+		func() {
+			defer func() {
+				if rr := recover(); rr != nil {
+					f.internalError(operationId, fmt.Errorf("cache deletion of operation %s panicked: %v", operationId, rr))
+				}
+			}()
+			c.Delete(operationId)
+		}()
+	}
+}
@@ -0,0 +1,115 @@
+package funnel
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Two funnels sharing a cache, e.g. on two instances, execute an operation once.
+func TestWithCache(t *testing.T) {
+	cache := NewMemoryCache()
+	nodeA := New(WithCacheTtl(time.Hour), WithCache(cache))
+	nodeB := New(WithCacheTtl(time.Hour), WithCache(cache))
+
+	var numOfExecutions int32
+	opExeFunc := func() (interface{}, error) {
+		atomic.AddInt32(&numOfExecutions, 1)
+		return "res", nil
+	}
+	res, _ := nodeA.Execute("opId", opExeFunc)
+	assert.Equal(t, "res", res)
+	assert.Eventually(t, func() bool {
+		_, found := cache.Get("opId")
+		return found
+	}, time.Second, time.Millisecond, "the result is written through once cached")
+
+	res, _ = nodeB.Execute("opId", opExeFunc)
+	assert.Equal(t, "res", res)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&numOfExecutions))
+	assert.True(t, nodeB.IsOpInProgress("opId"), "the result read from the cache is cached by the funnel")
+
+	nodeB.Forget("opId")
+	_, found := cache.Get("opId")
+	assert.False(t, found)
+	nodeB.Execute("opId", opExeFunc)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&numOfExecutions))
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	cache := NewMemoryCache()
+	cache.Set("opId", "res", time.Millisecond*10)
+	value, found := cache.Get("opId")
+	assert.True(t, found)
+	assert.Equal(t, "res", value)
+
+	time.Sleep(time.Millisecond * 20)
+	_, found = cache.Get("opId")
+	assert.False(t, found)
+}
+
+// bytesCache is an external cache, holding the encodings of the results like a remote cache would.
+type bytesCache struct {
+	sync.Mutex
+	values map[string][]byte
+}
+
+func (c *bytesCache) Get(operationId string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+	b, found := c.values[operationId]
+	return b, found
+}
+
+func (c *bytesCache) Set(operationId string, value interface{}, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[operationId] = value.([]byte)
+}
+
+func (c *bytesCache) Delete(operationId string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.values, operationId)
+}
+
+func TestWithCacheCodec(t *testing.T) {
+	encode := func(res interface{}) ([]byte, error) { return json.Marshal(res) }
+	decode := func(b []byte) (interface{}, error) {
+		var res map[string]int
+		err := json.Unmarshal(b, &res)
+		return res, err
+	}
+	cache := &bytesCache{values: map[string][]byte{}}
+	nodeA := New(WithCacheTtl(time.Hour), WithCache(cache), WithCodec(encode, decode))
+	nodeB := New(WithCacheTtl(time.Hour), WithCache(cache), WithCodec(encode, decode))
+
+	nodeA.Execute("opId", func() (interface{}, error) {
+		return map[string]int{"value": 42}, nil
+	})
+	assert.Eventually(t, func() bool {
+		_, found := cache.Get("opId")
+		return found
+	}, time.Second, time.Millisecond)
+	encoded, _ := cache.Get("opId")
+	assert.Equal(t, []byte(`{"value":42}`), encoded)
+
+	res, err := nodeB.Execute("opId", func() (interface{}, error) {
+		t.Error("the result should have been read from the cache")
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"value": 42}, res, "the cached value is decoded")
+}
+
+func TestWithCacheRequiresCodec(t *testing.T) {
+	cache := &bytesCache{values: map[string][]byte{}}
+	encode := func(res interface{}) ([]byte, error) { return json.Marshal(res) }
+	assert.Panics(t, func() { New(WithCache(cache)) })
+	assert.Panics(t, func() { New(WithCache(cache), WithCodec(encode, nil)) }, "the decoder is required as well")
+	assert.NotPanics(t, func() { New(WithCache(NewMemoryCache())) }, "an in-memory cache holds the results as is")
+}
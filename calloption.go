@@ -0,0 +1,43 @@
+package funnel
+
+import "time"
+
+// A CallOption configures a single request to the funnel, see Execute.
+type CallOption func(*callConfig)
+
+// WithCallTimeout defines the timeout of the request, overriding the funnel's timeout (see WithTimeout) for this request
+// only. Like the funnel's timeout it's measured from the start of the operation, so each request joining an operation
+// in process times out according to its own timeout. A request that times out before the funnel's timeout leaves the
+// operation in process for the other requests, rather than deleting it. A timeout of 0 or less keeps the funnel's timeout.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(call *callConfig) {
+		call.timeout = timeout
+	}
+}
+
+// WithCallDeadline defines the time at which the request times out, overriding the funnel's timeout (see WithTimeout)
+// and the request's timeout (see WithCallTimeout), e.g. the deadline of the incoming request of an RPC server on whose
+// behalf the operation is awaited. Each request joining an operation in process times out at its own deadline, and
+// like with WithCallTimeout, a request whose deadline comes before the funnel's timeout leaves the operation in process
+// for the other requests. A zero deadline keeps the timeout.
+func WithCallDeadline(deadline time.Time) CallOption {
+	return func(call *callConfig) {
+		call.deadline = deadline
+	}
+}
+
+// ExecuteWithDeadline is like Execute, but the request times out at the deadline (see WithCallDeadline).
+func (f *Funnel) ExecuteWithDeadline(deadline time.Time, operationId string, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
+	return f.Execute(operationId, opExeFunc, WithCallDeadline(deadline))
+}
+
+// waitTimeout returns the timeout of the request for the operation, measured from the start of the operation.
+func (call callConfig) waitTimeout(op *operationInProcess) time.Duration {
+	if !call.deadline.IsZero() {
+		return call.deadline.Sub(op.startTime)
+	}
+	if call.timeout > 0 {
+		return call.timeout
+	}
+	return op.config.timeout
+}
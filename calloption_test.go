@@ -0,0 +1,92 @@
+package funnel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallTimeoutOverridesFunnelTimeout(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond*50), WithCacheTtl(time.Hour))
+
+	res, err := fnl.Execute("slow", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 100)
+		return "slow", nil
+	}, WithCallTimeout(time.Second))
+	assert.Equal(t, "slow", res)
+	assert.Nil(t, err)
+
+	// Other operations keep the funnel's timeout.
+	_, err = fnl.Execute("other", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 100)
+		return "other", nil
+	})
+	assert.Equal(t, timeoutError, err)
+}
+
+// Each request joining the same operation times out according to its own timeout.
+func TestCallTimeoutPerRequest(t *testing.T) {
+	fnl := New(WithTimeout(time.Second), WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	results := make(chan interface{})
+	go func() {
+		res, _ := fnl.Execute("opId", func() (interface{}, error) {
+			<-release
+			return "res", nil
+		})
+		results <- res
+	}()
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+
+	start := time.Now()
+	_, err := fnl.Execute("opId", nil, WithCallTimeout(time.Millisecond*20))
+	assert.Equal(t, timeoutError, err)
+	assert.Less(t, time.Since(start), time.Millisecond*500)
+
+	// The operation was not deleted by the request giving up early, so its result is still cached for the others.
+	assert.True(t, fnl.IsOpInProgress("opId"))
+	close(release)
+	assert.Equal(t, "res", <-results)
+	res, err := fnl.Execute("opId", nil, WithCallTimeout(time.Millisecond*20))
+	assert.Equal(t, "res", res)
+	assert.Nil(t, err)
+}
+
+// Each request joining the same operation times out at its own deadline, even past the funnel's timeout.
+func TestExecuteWithDeadline(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond*100), WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	defer close(release)
+	start := time.Now()
+	go fnl.ExecuteWithDeadline(start.Add(time.Second), "opId", func() (interface{}, error) {
+		<-release
+		return "res", nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+
+	timedOut := make(chan time.Duration, 2)
+	for _, deadline := range []time.Duration{time.Millisecond * 30, time.Millisecond * 200} {
+		go func(deadline time.Duration) {
+			_, err := fnl.ExecuteWithDeadline(start.Add(deadline), "opId", nil)
+			assert.Equal(t, timeoutError, err)
+			timedOut <- time.Since(start)
+		}(deadline)
+	}
+
+	assert.Less(t, <-timedOut, time.Millisecond*100)
+	assert.True(t, fnl.IsOpInProgress("opId"), "a request timing out before the funnel's timeout leaves the operation")
+	assert.GreaterOrEqual(t, <-timedOut, time.Millisecond*200, "the deadline overrides the funnel's timeout")
+}
+
+func TestErrTimeout(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond * 10))
+
+	_, err := fnl.Execute("slow", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 50)
+		return nil, nil
+	})
+	assert.ErrorIs(t, err, ErrTimeout)
+}
@@ -0,0 +1,74 @@
+package funnel
+
+import "errors"
+
+// ErrCanceled is matched by the errors returned to the requests for an operation that was canceled, see CanceledError.
+var ErrCanceled = errors.New("Operation was canceled")
+
+// CanceledError is the error returned to the requests for an operation that was canceled, either by Cancel or because
+// the context of the request was done. It carries the reason of the cancellation and unwraps to it, so that errors.Is
+// and errors.As match the reason as well as ErrCanceled.
+type CanceledError struct {
+	OperationId string
+
+	// The reason passed to Cancel, or the cause of the context (see context.Cause).
+	Reason error
+}
+
+// Error returns the identifier of the canceled operation along with the reason.
+func (e *CanceledError) Error() string {
+	if e.Reason == nil {
+		return "operation " + e.OperationId + " was canceled"
+	}
+	return "operation " + e.OperationId + " was canceled: " + e.Reason.Error()
+}
+
+// Is reports whether the target is ErrCanceled.
+func (e *CanceledError) Is(target error) bool {
+	return target == ErrCanceled
+}
+
+// Unwrap returns the reason of the cancellation.
+func (e *CanceledError) Unwrap() error {
+	return e.Reason
+}
+
+// Cancel cancels the operation in process, releasing all the goroutines waiting for it with a *CanceledError carrying
+// the reason. The operation is deleted from the funnel, so the next request re-executes it. The execution isn't
+// interrupted, unless it was started by ExecuteContext, in which case its context is canceled with the *CanceledError
+// as the cause; either way its result is discarded once it returns. Returns true if an operation in process was
+// canceled; an operation whose result is already available is not affected (see Forget).
+func (f *Funnel) Cancel(operationId string, reason error) bool {
+	operationId = f.key(operationId)
+
+	f.Lock()
+	defer f.Unlock()
+
+	op, found := f.findOperation(operationId)
+	if !found {
+		return false
+	}
+	return f.cancel(op, reason)
+}
+
+// cancel cancels the operation unless it completed, and reports whether it did. Must be called with the lock held, on
+// an operation that was not deleted yet.
+func (f *Funnel) cancel(op *operationInProcess, reason error) bool {
+	if op.completed.IsSet() {
+		return false
+	}
+	// An operation that ended with panic is done without being completed.
+	select {
+	case <-op.done:
+		return false
+	default:
+	}
+
+	f.removeOperation(op)
+	op.cancelErr = &CanceledError{OperationId: op.operationId, Reason: reason}
+	if op.cancelExec != nil {
+		op.cancelExec(op.cancelErr)
+	}
+	close(op.done)
+	return true
+}
@@ -0,0 +1,97 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intuit/funnel/internal/schedule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancel(t *testing.T) {
+	gate := newPointGate(schedule.BeforeExecute)
+	fnl := New(WithCacheTtl(time.Hour), gate.option())
+
+	numOfWaiters := 5
+	var wg sync.WaitGroup
+	wg.Add(numOfWaiters)
+	errs := make(chan error, numOfWaiters)
+	for i := 0; i < numOfWaiters; i++ {
+		go func() {
+			defer wg.Done()
+			_, err := fnl.Execute("opId", func() (interface{}, error) {
+				return "stale", nil
+			})
+			errs <- err
+		}()
+	}
+	<-gate.reached
+	for !func() bool { fnl.Lock(); defer fnl.Unlock(); return fnl.opInProcess["opId"].served == numOfWaiters }() {
+		time.Sleep(time.Millisecond)
+	}
+
+	reason := errors.New("tenant deleted")
+	assert.True(t, fnl.Cancel("opId", reason))
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		var canceled *CanceledError
+		assert.True(t, errors.As(err, &canceled))
+		assert.Equal(t, "opId", canceled.OperationId)
+		assert.True(t, errors.Is(err, ErrCanceled))
+		assert.True(t, errors.Is(err, reason))
+		assert.Equal(t, "operation opId was canceled: tenant deleted", err.Error())
+	}
+
+	// The result of the canceled execution is discarded.
+	close(gate.release)
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return "fresh", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", res)
+
+	// A result that is already available is not canceled.
+	assert.False(t, fnl.Cancel("opId", reason))
+	assert.False(t, fnl.Cancel("other", reason))
+}
+
+func TestCancelPromise(t *testing.T) {
+	fnl := New()
+	release := make(chan empty)
+	defer close(release)
+	opExeFunc := func() (interface{}, error) {
+		<-release
+		return nil, nil
+	}
+
+	promise := fnl.Submit("opId", opExeFunc)
+	reason := errors.New("shutting down")
+	fnl.Cancel("opId", reason)
+	<-promise.Done()
+	_, err, done := promise.Poll()
+	assert.True(t, done)
+	assert.True(t, errors.Is(err, reason))
+
+	// The cause of the context is the reason when the context of the request is done.
+	promise = fnl.Submit("other", opExeFunc)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(reason)
+	_, err = promise.Await(ctx)
+	assert.True(t, errors.Is(err, ErrCanceled))
+	assert.True(t, errors.Is(err, reason))
+}
+
+// The panic of an operation is cached like its result, so canceling it does nothing.
+func TestCancelPanicked(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	assert.Panics(t, func() {
+		fnl.Execute("opId", func() (interface{}, error) { panic("test ends with panic") })
+	})
+
+	assert.False(t, fnl.Cancel("opId", errors.New("canceled")))
+	assert.Panics(t, func() { fnl.Execute("opId", nil) }, "the panic is still cached")
+}
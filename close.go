@@ -0,0 +1,68 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrFunnelClosed is returned by the requests made once the funnel was closed, see Close.
+var ErrFunnelClosed = errors.New("Funnel is closed")
+
+// Close closes the funnel: the requests made from now on return ErrFunnelClosed, including the ones for cached results,
+// and the background work of the funnel is stopped: the global flush (see WithGlobalFlushInterval), the compaction of
+// its map (see WithMapCompaction), the deletion of the expired results and the subscription to the backend (see
+// WithBackend). The operations in process keep executing and their waiters receive their results, see Shutdown for
+// waiting for them. Close may be called more than once, and always returns nil.
+func (f *Funnel) Close() error {
+	unsubscribe := false
+	defer func() {
+		// Unsubscribed once the lock is released, since the backend is user code.
+		if unsubscribe {
+			f.backend.Unsubscribe(f.invalidations)
+		}
+	}()
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.closeOnce.Do(func() {
+		unsubscribe = f.backend != nil
+		close(f.closed)
+		if f.expiryTimer != nil {
+			f.expiryTimer.Stop()
+		}
+		if f.compaction != nil {
+			f.compaction.Stop()
+			f.compaction = nil
+		}
+	})
+	return nil
+}
+
+// Shutdown closes the funnel like Close, and waits for the executions of the operations in process to return, or for
+// the context to be done, in which case it returns the context's error while the executions keep running.
+func (f *Funnel) Shutdown(ctx context.Context) error {
+	f.Close()
+
+	done := make(chan empty)
+	go func() {
+		f.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isClosed reports whether the funnel was closed.
+func (f *Funnel) isClosed() bool {
+	select {
+	case <-f.closed:
+		return true
+	default:
+		return false
+	}
+}
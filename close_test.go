@@ -0,0 +1,66 @@
+package funnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClose(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	fnl.Execute("cached", func() (interface{}, error) {
+		return "res", nil
+	})
+
+	release := make(chan empty)
+	inProcess := fnl.Submit("in process", func() (interface{}, error) {
+		<-release
+		return "in process", nil
+	})
+	assert.Nil(t, fnl.Close())
+	assert.Nil(t, fnl.Close())
+
+	// Requests made once closed are rejected, whether cached or not.
+	for _, id := range []string{"cached", "in process", "new"} {
+		res, err := fnl.Execute(id, func() (interface{}, error) {
+			t.Error("a closed funnel must not execute operations")
+			return nil, nil
+		})
+		assert.Nil(t, res)
+		assert.Equal(t, ErrFunnelClosed, err)
+	}
+
+	// The operations in process still deliver their results.
+	close(release)
+	res, err := inProcess.Await(context.Background())
+	assert.Equal(t, "in process", res)
+	assert.Nil(t, err)
+}
+
+func TestShutdown(t *testing.T) {
+	fnl := New()
+
+	release := make(chan empty)
+	returned := make(chan empty)
+	fnl.Submit("opId", func() (interface{}, error) {
+		<-release
+		close(returned)
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, fnl.Shutdown(ctx))
+
+	close(release)
+	assert.Nil(t, fnl.Shutdown(context.Background()))
+	select {
+	case <-returned:
+	default:
+		t.Error("Shutdown should wait for the executions to return")
+	}
+	_, err := fnl.Execute("opId", nil)
+	assert.Equal(t, ErrFunnelClosed, err)
+}
@@ -0,0 +1,50 @@
+package funnel
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errNoFunctions = errors.New("No function was provided for the operation")
+
+// ExecuteAny is like Execute, but the operation is made of several functions (e.g. identical requests to redundant
+// backends) that are executed concurrently. The first function to return without an error determines the result of the
+// operation for all the requesting callers and its result is cached as usual; the results of the other functions are discarded.
+// If all of the functions fail, the returned error joins all of their errors. A function that panics counts as failed.
+// The functions that lose the race are not interrupted, they keep running in their own goroutines until they return
+// and their results are dropped. Calling ExecuteAny without any function returns an error without touching the funnel.
+func (f *Funnel) ExecuteAny(operationId string, funcs ...func() (interface{}, error)) (res interface{}, err error) {
+	if len(funcs) == 0 {
+		return nil, errNoFunctions
+	}
+	return f.Execute(operationId, firstSuccess(funcs))
+}
+
+// firstSuccess returns a function that executes all the given functions concurrently and returns the first successful result.
+func firstSuccess(funcs []func() (interface{}, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		// The channel is buffered so that functions completing after the first success don't block forever.
+		results := make(chan opResult, len(funcs))
+		for i, fn := range funcs {
+			go func(i int, fn func() (interface{}, error)) {
+				defer func() {
+					if rr := recover(); rr != nil {
+						results <- opResult{err: fmt.Errorf("function %d panicked: %v", i, rr)}
+					}
+				}()
+				res, err := fn()
+				results <- opResult{res: res, err: err}
+			}(i, fn)
+		}
+
+		errs := make([]error, 0, len(funcs))
+		for range funcs {
+			r := <-results
+			if r.err == nil {
+				return r.res, nil
+			}
+			errs = append(errs, r.err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
@@ -0,0 +1,80 @@
+package funnel
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteAny(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	var numOfExecutions uint64
+	backend := func(delay time.Duration, res interface{}, err error) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			atomic.AddUint64(&numOfExecutions, 1)
+			time.Sleep(delay)
+			return res, err
+		}
+	}
+	backends := []func() (interface{}, error){
+		backend(time.Millisecond*200, "slow", nil),
+		backend(time.Millisecond*10, nil, errors.New("fast failure")),
+		backend(time.Millisecond*50, "fast", nil),
+	}
+
+	var wg sync.WaitGroup
+	numOfGoroutines := 10
+	wg.Add(numOfGoroutines)
+	start := time.Now()
+	for i := 0; i < numOfGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			res, err := fnl.ExecuteAny("opId", backends...)
+			assert.Equal(t, "fast", res)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, time.Since(start) < time.Millisecond*200, "Expected the slow backend to be ignored")
+	assert.Equal(t, uint64(len(backends)), atomic.LoadUint64(&numOfExecutions))
+
+	// The combined result is cached.
+	res, err := fnl.ExecuteAny("opId", backend(0, "other", nil))
+	assert.Equal(t, "fast", res)
+	assert.Nil(t, err)
+}
+
+func TestExecuteAnyAllFail(t *testing.T) {
+	fnl := New()
+
+	err1, err2 := errors.New("first failure"), errors.New("second failure")
+	res, err := fnl.ExecuteAny("opId",
+		func() (interface{}, error) { return nil, err1 },
+		func() (interface{}, error) { return nil, err2 },
+		func() (interface{}, error) { panic("test ends with panic") },
+	)
+
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, err1))
+	assert.True(t, errors.Is(err, err2))
+	assert.Contains(t, err.Error(), "test ends with panic")
+
+}
+
+func TestExecuteAnyWithoutFunctions(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	_, err := fnl.ExecuteAny("opId")
+	assert.Equal(t, errNoFunctions, err)
+
+	// The error is not cached for the operation.
+	res, err := fnl.ExecuteAny("opId", func() (interface{}, error) { return "value", nil })
+	assert.Equal(t, "value", res)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,58 @@
+package funnel
+
+import "time"
+
+// minCompactPeak is the number of operations under which the funnel's map is never compacted, since its footprint is
+// negligible.
+const minCompactPeak = 1024
+
+// grown records the number of operations held by the funnel once one was added, see WithMapCompaction. Must be called
+// with the lock held.
+func (f *Funnel) grown() {
+	n := len(f.opInProcess)
+	if n > f.peakOps {
+		f.peakOps = n
+	}
+
+	// The occupancy recovered before the compaction, which would only be followed by the map growing again.
+	if f.compaction != nil && n*4 > f.peakOps {
+		f.compaction.Stop()
+		f.compaction = nil
+	}
+}
+
+// shrunk schedules the compaction of the funnel's map once an operation was removed and the map is occupied below a
+// quarter of its peak, see WithMapCompaction. Must be called with the lock held.
+func (f *Funnel) shrunk() {
+	stable := f.currentConfig().compactAfter
+	if stable <= 0 || f.compaction != nil || f.peakOps < minCompactPeak || len(f.opInProcess)*4 > f.peakOps || f.isClosed() {
+		return
+	}
+	var compaction *time.Timer
+	compaction = time.AfterFunc(stable, func() {
+		f.Lock()
+		defer f.Unlock()
+
+		// A compaction canceled once the timer fired may have been followed by another one, which is left pending.
+		if f.compaction != compaction {
+			return
+		}
+		f.compaction = nil
+		f.compact()
+	})
+	f.compaction = compaction
+}
+
+// compact rebuilds the funnel's map into a map sized for the operations it holds, if its occupancy remained low. Must be
+// called with the lock held.
+func (f *Funnel) compact() {
+	if len(f.opInProcess)*4 > f.peakOps {
+		return
+	}
+	opInProcess := make(map[string]*operationInProcess, len(f.opInProcess))
+	for id, op := range f.opInProcess {
+		opInProcess[id] = op
+	}
+	f.opInProcess = opInProcess
+	f.peakOps = len(opInProcess)
+}
@@ -0,0 +1,98 @@
+package funnel
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// heapAlloc returns the bytes allocated on the heap once garbage collected.
+func heapAlloc() int64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
+
+// pendingCompaction returns the pending compaction of the funnel's map, nil if none.
+func (f *Funnel) pendingCompaction() *time.Timer {
+	f.Lock()
+	defer f.Unlock()
+	return f.compaction
+}
+
+func executeBurst(fnl *Funnel, prefix string, numOfOps int) {
+	for i := 0; i < numOfOps; i++ {
+		fnl.Execute(prefix+strconv.Itoa(i), func() (interface{}, error) {
+			return i, nil
+		})
+	}
+}
+
+func forgetAll(fnl *Funnel) {
+	fnl.ForgetMatching(func(string) bool { return true })
+}
+
+func TestMapCompaction(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithMapCompaction(time.Hour))
+	defer fnl.Close()
+
+	baseline := heapAlloc()
+	executeBurst(fnl, "burst", 50000)
+	forgetAll(fnl)
+	retained := heapAlloc()
+	assert.NotNil(t, fnl.pendingCompaction())
+
+	// Compacted once the stable period elapsed, the map releases the memory it was sized with.
+	fnl.Lock()
+	fnl.compact()
+	fnl.Unlock()
+	compacted := heapAlloc()
+	assert.Less(t, compacted-baseline, (retained-baseline)/2, "the memory of the map should have been released")
+}
+
+func TestMapCompactionChurn(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithMapCompaction(time.Hour))
+	defer fnl.Close()
+
+	executeBurst(fnl, "burst", 4000)
+	forgetAll(fnl)
+	assert.NotNil(t, fnl.pendingCompaction())
+
+	// The map grows back above a quarter of its peak before the stable period elapsed, so it's not compacted.
+	executeBurst(fnl, "next", 2000)
+	assert.Nil(t, fnl.pendingCompaction())
+}
+
+func TestMapCompactionCanceledOnceFired(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithMapCompaction(time.Millisecond))
+	defer fnl.Close()
+	executeBurst(fnl, "burst", 4000)
+
+	// The compaction fires while the lock is held, and is canceled and followed by another one meanwhile.
+	fnl.Lock()
+	for operationId := range fnl.opInProcess {
+		delete(fnl.opInProcess, operationId)
+	}
+	fnl.shrunk()
+	time.Sleep(time.Millisecond * 20)
+	fnl.compaction.Stop()
+	pending := time.NewTimer(time.Hour)
+	fnl.compaction = pending
+	fnl.Unlock()
+
+	time.Sleep(time.Millisecond * 20)
+	assert.Equal(t, pending, fnl.pendingCompaction(), "the canceled compaction should leave the next one pending")
+}
+
+func TestMapCompactionDisabled(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	defer fnl.Close()
+
+	executeBurst(fnl, "burst", 2000)
+	forgetAll(fnl)
+	assert.Nil(t, fnl.pendingCompaction())
+}
@@ -0,0 +1,100 @@
+package funnel
+
+// ConcurrentResultPolicy selects which of the concurrent executions of an operation provides its cached result, see
+// WithPerKeyConcurrency and WithConcurrentResultPolicy.
+type ConcurrentResultPolicy int
+
+const (
+	// FirstWins caches the result of the execution that returned first, the results of the other executions are
+	// delivered to their waiters only.
+	FirstWins ConcurrentResultPolicy = iota
+
+	// LastWins caches the result of the execution that returned last, the results of the executions returning while
+	// another one is still in process are delivered to their waiters only.
+	LastWins
+)
+
+// String returns the name of the policy.
+func (p ConcurrentResultPolicy) String() string {
+	switch p {
+	case FirstWins:
+		return "FirstWins"
+	case LastWins:
+		return "LastWins"
+	}
+	return "Unknown"
+}
+
+// concurrentExecutions holds the executions started concurrently for an operation identifier. The funnel's lock guards it.
+type concurrentExecutions struct {
+	// The executions in the order they started, the first being the operation the request found in the funnel.
+	ops []*operationInProcess
+
+	// The index of the execution the next joining request waits for.
+	next int
+
+	// true once an execution returned, after which no other execution is cached with FirstWins.
+	settled bool
+}
+
+// joinConcurrent is called for a request that found the operation in process. It returns true when the request should
+// start another execution of the operation, otherwise the execution the request should wait for. Must be called with
+// the lock held.
+func (f *Funnel) joinConcurrent(op *operationInProcess) (joined *operationInProcess, start bool) {
+	if op.config.perKeyConcurrency <= 1 {
+		return op, false
+	}
+	if op.concurrent == nil {
+		op.concurrent = &concurrentExecutions{ops: []*operationInProcess{op}}
+	}
+	executions := op.concurrent
+	if len(executions.ops) < op.config.perKeyConcurrency {
+		return nil, true
+	}
+
+	// The requests are distributed in turn among the executions still in process.
+	for range executions.ops {
+		joined = executions.ops[executions.next%len(executions.ops)]
+		executions.next++
+		if !joined.completed.IsSet() && !joined.deleted.IsSet() {
+			return joined, false
+		}
+	}
+	return op, false
+}
+
+// settleConcurrent decides whether the concurrent execution that just returned provides the cached result of its
+// operation, in which case it replaces the operation it was started with in the funnel. Must be called with the lock held.
+func (f *Funnel) settleConcurrent(op *operationInProcess) bool {
+	executions := op.concurrent
+	switch op.config.concurrentResultPolicy {
+	case FirstWins:
+		if executions.settled {
+			return false
+		}
+		executions.settled = true
+	case LastWins:
+		// An execution still in process would replace the result.
+		for _, other := range executions.ops {
+			if other != op && !other.completed.IsSet() && !other.deleted.IsSet() {
+				return false
+			}
+		}
+	}
+
+	current, found := f.opInProcess[op.operationId]
+	if current == op {
+		return true
+	}
+	// The executions' operation was deleted meanwhile (e.g. forgotten or expired), possibly re-created since.
+	if !found || current.concurrent != executions {
+		return false
+	}
+
+	f.removeOperation(current)
+	op.deps = current.deps
+	f.opInProcess[op.operationId] = op
+	f.grown()
+	f.registerDeps(op)
+	return true
+}
@@ -0,0 +1,79 @@
+package funnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// executeConcurrently starts two concurrent executions of the same operation, returning a and b, lets b return before a
+// and returns the result cached once both returned.
+func executeConcurrently(t *testing.T, fnl *Funnel) interface{} {
+	release := map[string]chan empty{"a": make(chan empty), "b": make(chan empty)}
+	results := map[string]chan interface{}{"a": make(chan interface{}), "b": make(chan interface{})}
+	for _, value := range []string{"a", "b"} {
+		started := make(chan empty)
+		go func(value string) {
+			res, err := fnl.Execute("op", func() (interface{}, error) {
+				close(started)
+				<-release[value]
+				return value, nil
+			})
+			assert.Nil(t, err)
+			results[value] <- res
+		}(value)
+		<-started
+	}
+
+	for _, value := range []string{"b", "a"} {
+		close(release[value])
+		assert.Equal(t, value, <-results[value])
+	}
+
+	res, err := fnl.Execute("op", func() (interface{}, error) {
+		t.Error("the operation must be cached")
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	return res
+}
+
+func TestConcurrentResultPolicyFirstWins(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Minute), WithPerKeyConcurrency(2))
+	assert.Equal(t, "b", executeConcurrently(t, fnl))
+}
+
+func TestConcurrentResultPolicyLastWins(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Minute), WithPerKeyConcurrency(2), WithConcurrentResultPolicy(LastWins))
+	assert.Equal(t, "a", executeConcurrently(t, fnl))
+}
+
+func TestPerKeyConcurrencyDistributesWaiters(t *testing.T) {
+	fnl := New(WithPerKeyConcurrency(2))
+
+	release := make(chan empty)
+	numOfExecutions := 0
+	opExeFunc := func() (interface{}, error) {
+		fnl.Lock()
+		numOfExecutions++
+		execution := numOfExecutions
+		fnl.Unlock()
+		<-release
+		return execution, nil
+	}
+	promises := make([]*Promise, 4)
+	for i := range promises {
+		promises[i] = fnl.Submit("op", opExeFunc)
+	}
+	close(release)
+
+	executions := map[interface{}]int{}
+	for _, promise := range promises {
+		res, err := promise.Await(context.Background())
+		assert.Nil(t, err)
+		executions[res]++
+	}
+	assert.Equal(t, map[interface{}]int{1: 2, 2: 2}, executions)
+}
@@ -0,0 +1,71 @@
+package funnel
+
+import "time"
+
+// NewConfig returns a configuration with the given options applied to the defaults, as New does, for replacing the
+// configuration of a funnel with SwapConfig. NewConfig panics if the options are inconsistent.
+func NewConfig(option ...Option) Config {
+	cfg := Config{
+		timeout:  time.Duration(time.Minute),
+		cacheTtl: 0,
+		shouldCache: func(s interface{}, err error) bool {
+			return true
+		},
+		identity: defaultIdentity,
+	}
+
+	for _, opt := range option {
+		opt(&cfg)
+	}
+	cfg.validate()
+	return cfg
+}
+
+// validate panics if the configuration is inconsistent, or lacks the defaults of NewConfig (e.g. the zero Config).
+func (cfg *Config) validate() {
+	if cfg.shouldCache == nil || cfg.identity == nil {
+		panic("funnel: the cache predicate and the identity function can't be nil, see NewConfig")
+	}
+	if cfg.validateSerializable && cfg.encode == nil {
+		panic("funnel: WithValidateSerializable requires a codec, see WithCodec")
+	}
+	if cfg.encodesCached() && (cfg.encode == nil || cfg.decode == nil) {
+		panic("funnel: an external cache requires a codec with a decoder, see WithCache and WithCodec")
+	}
+	if cfg.cacheTtl < 0 || cfg.negativeCacheTtl < 0 || cfg.slidingCacheTtl < 0 {
+		panic("funnel: a cache time-to-live can't be negative, a time-to-live of 0 prohibits caching")
+	}
+	if cfg.cacheTtlJitter < 0 || cfg.cacheTtlJitter > 1 {
+		panic("funnel: the cache time-to-live jitter must be a fraction between 0 and 1")
+	}
+	if cfg.cacheTtl > 0 && cfg.slidingCacheTtl > 0 {
+		panic("funnel: WithCacheTtl and WithSlidingCacheTtl are mutually exclusive")
+	}
+}
+
+// SwapConfig replaces the configuration of the funnel with the given one (see NewConfig) and returns the previous one,
+// so that it can be restored later. The configuration is replaced as a whole and atomically: the operations created
+// afterwards use the new configuration, while the operations already in process or cached keep the configuration they
+// were created with (e.g. their timeout and cache time-to-live). The funnel keeps its name when the new configuration
+// has none.
+// The settings New sets the funnel up with are not replaced: the concurrency budget, the per-key rate, the maximum
+// number of cached results and its eviction policy, the global flush interval, the expvar name and the backend.
+// SwapConfig panics if the configuration wasn't created by NewConfig, e.g. for the zero Config.
+func (f *Funnel) SwapConfig(config Config) Config {
+	config.validate()
+
+	f.Lock()
+	defer f.Unlock()
+
+	old := f.currentConfig()
+	if config.name == "" {
+		config.name = old.name
+	}
+	f.config.Store(&config)
+	return *old
+}
+
+// currentConfig returns the configuration of the funnel, for the operations created from now on.
+func (f *Funnel) currentConfig() *Config {
+	return f.config.Load()
+}
@@ -0,0 +1,87 @@
+package funnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwapConfig(t *testing.T) {
+	fnl := New(WithName("swapped"), WithCacheTtl(time.Minute))
+
+	// An operation in process keeps its configuration, it's still cached once it returns.
+	release := make(chan empty)
+	inProcess := fnl.Submit("in process", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	old := fnl.SwapConfig(NewConfig(WithCacheTtl(0)))
+	close(release)
+	res, err := inProcess.Await(context.Background())
+	assert.Equal(t, 1, res)
+	assert.Nil(t, err)
+	assert.True(t, fnl.IsOpInProgress("in process"))
+	assert.Equal(t, "swapped", fnl.Name())
+
+	// A new operation uses the new configuration, it's not cached.
+	fnl.Execute("new", func() (interface{}, error) {
+		return 2, nil
+	})
+	assert.False(t, fnl.IsOpInProgress("new"))
+
+	// Once restored, the old configuration applies to the new operations again.
+	assert.Equal(t, time.Duration(0), fnl.SwapConfig(old).cacheTtl)
+	fnl.Execute("restored", func() (interface{}, error) {
+		return 3, nil
+	})
+	assert.True(t, fnl.IsOpInProgress("restored"))
+}
+
+func TestSwapConfigTimeout(t *testing.T) {
+	fnl := New(WithTimeout(time.Minute))
+
+	release := make(chan empty)
+	defer close(release)
+	inProcess := fnl.Submit("in process", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	fnl.SwapConfig(NewConfig(WithTimeout(time.Millisecond * 10)))
+
+	_, err := fnl.Execute("new", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	assert.Equal(t, timeoutError, err)
+
+	// The operation in process keeps its timeout, its waiters give up on their own deadline first.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = inProcess.Await(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestNegativeCacheTtlRejected(t *testing.T) {
+	assert.Panics(t, func() { New(WithCacheTtl(-time.Second)) })
+	assert.Panics(t, func() { NewConfig(WithNegativeCacheTtl(-time.Second)) }, "SwapConfig takes a checked configuration as well")
+
+	// A time-to-live of 0 prohibits caching.
+	fnl := New(WithCacheTtl(0))
+	fnl.Execute("opId", func() (interface{}, error) { return nil, nil })
+	assert.False(t, fnl.IsOpInProgress("opId"))
+}
+
+func TestSwapConfigRejected(t *testing.T) {
+	fnl := New()
+	assert.Panics(t, func() { fnl.SwapConfig(Config{}) })
+
+	// An inconsistent configuration is rejected by SwapConfig as it is by NewConfig.
+	cfg := NewConfig()
+	cfg.cacheTtl = -time.Second
+	assert.Panics(t, func() { fnl.SwapConfig(cfg) })
+
+	fnl.Execute("opId", func() (interface{}, error) { return nil, nil })
+	assert.Equal(t, time.Minute, fnl.currentConfig().timeout, "the configuration should have been kept")
+}
@@ -0,0 +1,55 @@
+package funnel
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext carries the values of its parent, but neither its deadline nor its cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+func (c detachedContext) Value(key interface{}) interface{}     { return c.parent.Value(key) }
+
+// ExecuteContext is like Execute, but the operation's function receives a context, and the request stops waiting once
+// its context is done, returning a *CanceledError with the context's cause.
+// The execution is shared by all the requests coalesced with the one that started it (the initiator), so its context
+// carries the values of the initiator's context, such as the trace context, making the spans of the execution children
+// of the initiator's span, but not the initiator's deadline or cancellation: the initiator giving up doesn't fail the
+// other requests. The execution's context is canceled only when the operation is canceled (see Cancel), or abandoned
+// by all of its requests (see WithCancelAbandoned).
+// Use WithOnExecuted to annotate the initiator's span with the number of coalesced requests.
+func (f *Funnel) ExecuteContext(ctx context.Context, operationId string, opExeFunc func(ctx context.Context) (interface{}, error)) (res interface{}, err error) {
+	return f.executeContext(ctx, callConfig{cost: 1}, operationId, opExeFunc)
+}
+
+// executeContext performs a request with a context, see ExecuteContext.
+func (f *Funnel) executeContext(ctx context.Context, call callConfig, operationId string, opExeFunc func(ctx context.Context) (interface{}, error)) (res interface{}, err error) {
+	execCtx, cancelExec := context.WithCancelCause(detachedContext{ctx})
+	call.ctx, call.execCtx, call.cancelExec = ctx, execCtx, cancelExec
+	call.spanCtx = &execCtx
+	return f.execute(operationId, call, func() (interface{}, error) {
+		return opExeFunc(execCtx)
+	})
+}
+
+// executed notifies the execution handler, if any, that the operation's execution returned.
+func (f *Funnel) executed(op *operationInProcess) {
+	if op.config.onExecuted == nil {
+		return
+	}
+
+	f.Lock()
+	served := op.served
+	f.Unlock()
+
+	ctx := op.execCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	op.config.onExecuted(ctx, op.operationId, served)
+}
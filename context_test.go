@@ -0,0 +1,112 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intuit/funnel/internal/schedule"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestExecuteContextPropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	gate := newPointGate(schedule.BeforeExecute)
+	fnl := New(gate.option(), WithOnExecuted(func(ctx context.Context, operationId string, served int) {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int("funnel.coalesced", served))
+	}))
+	opExeFunc := func(ctx context.Context) (interface{}, error) {
+		_, span := tracer.Start(ctx, "downstream")
+		span.End()
+		return "res", nil
+	}
+
+	numOfRequests := 3
+	var wg sync.WaitGroup
+	wg.Add(numOfRequests)
+	initiatorCtx, initiator := tracer.Start(context.Background(), "initiator")
+	go func() {
+		defer wg.Done()
+		defer initiator.End()
+		res, err := fnl.ExecuteContext(initiatorCtx, "opId", opExeFunc)
+		assert.Nil(t, err)
+		assert.Equal(t, "res", res)
+	}()
+	<-gate.reached
+	for i := 1; i < numOfRequests; i++ {
+		go func() {
+			defer wg.Done()
+			ctx, span := tracer.Start(context.Background(), "joiner")
+			defer span.End()
+			res, err := fnl.ExecuteContext(ctx, "opId", opExeFunc)
+			assert.Nil(t, err)
+			assert.Equal(t, "res", res)
+		}()
+	}
+	for served := 0; served < numOfRequests; {
+		time.Sleep(time.Millisecond)
+		fnl.Lock()
+		served = fnl.opInProcess["opId"].served
+		fnl.Unlock()
+	}
+	close(gate.release)
+	wg.Wait()
+
+	var downstream []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "downstream":
+			downstream = append(downstream, span)
+		case "initiator":
+			assert.Contains(t, span.Attributes(), attribute.Int("funnel.coalesced", numOfRequests))
+		}
+	}
+	if assert.Len(t, downstream, 1) {
+		assert.Equal(t, initiator.SpanContext().SpanID(), downstream[0].Parent().SpanID())
+		assert.Equal(t, initiator.SpanContext().TraceID(), downstream[0].SpanContext().TraceID())
+	}
+}
+
+func TestExecuteContextDetachedFromInitiator(t *testing.T) {
+	fnl := New()
+
+	// The initiator giving up doesn't cancel the execution shared with the other requests.
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan empty)
+	execErr := make(chan error, 1)
+	opExeFunc := func(execCtx context.Context) (interface{}, error) {
+		<-release
+		execErr <- execCtx.Err()
+		return "res", nil
+	}
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		cancel()
+	}()
+	_, err := fnl.ExecuteContext(ctx, "opId", opExeFunc)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, errors.Is(err, ErrCanceled))
+	close(release)
+	assert.Nil(t, <-execErr)
+
+	// Cancel cancels the execution's context, with the cancellation as its cause.
+	reason := errors.New("shutting down")
+	started := make(chan empty)
+	go fnl.ExecuteContext(context.Background(), "canceled", func(execCtx context.Context) (interface{}, error) {
+		close(started)
+		<-execCtx.Done()
+		execErr <- context.Cause(execCtx)
+		return nil, execCtx.Err()
+	})
+	<-started
+	fnl.Cancel("canceled", reason)
+	assert.True(t, errors.Is(<-execErr, reason))
+}
@@ -0,0 +1,44 @@
+package funnel
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCopyTimeout is returned by ExecuteAndCopyResult when copying the result took longer than the copy timeout, see
+// WithCopyTimeout.
+var ErrCopyTimeout = errors.New("Copying the operation result exceeded the copy timeout")
+
+// copyOutcome is the outcome of a copy made on a goroutine of its own.
+type copyOutcome struct {
+	copied    interface{}
+	recovered interface{}
+}
+
+// copyWithin makes the copy on a goroutine of its own and returns it, or ErrCopyTimeout if it's not made within the
+// timeout. Since a copy can't be interrupted, an abandoned copy keeps running and its result is dropped. A panic of the
+// copy is raised again in the caller's goroutine.
+func copyWithin(timeout time.Duration, copyRes func() interface{}) (interface{}, error) {
+	outcome := make(chan copyOutcome, 1) // Buffered, so that an abandoned copy doesn't block.
+	go func() {
+		defer func() {
+			if rr := recover(); rr != nil {
+				outcome <- copyOutcome{recovered: rr}
+			}
+		}()
+		outcome <- copyOutcome{copied: copyRes()}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case o := <-outcome:
+		if o.recovered != nil {
+			panic(o.recovered)
+		}
+		return o.copied, nil
+	case <-timer.C:
+		return nil, ErrCopyTimeout
+	}
+}
@@ -0,0 +1,110 @@
+package funnel
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type copied struct {
+	Values map[string]int
+}
+
+func newCopied() *copied {
+	c := &copied{Values: make(map[string]int)}
+	for i := 0; i < 1000; i++ {
+		c.Values[strconv.Itoa(i)] = i
+	}
+	return c
+}
+
+func TestWithCopyCache(t *testing.T) {
+	cacheTtl := time.Millisecond * 50
+	fnl := New(WithCacheTtl(cacheTtl), WithCopyCache(true))
+	opExeFunc := func() (interface{}, error) {
+		return newCopied(), nil
+	}
+
+	shared, _ := fnl.Execute("opId", opExeFunc)
+	numOfGoroutines := 10
+	copies := make([]interface{}, numOfGoroutines)
+	var wg sync.WaitGroup
+	wg.Add(numOfGoroutines)
+	for i := 0; i < numOfGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			copies[i], _ = fnl.ExecuteAndCopyResult("opId", opExeFunc)
+		}(i)
+	}
+	wg.Wait()
+
+	// The copy-callers of an execution share the copy, which is isolated from the shared result.
+	assert.Equal(t, shared, copies[0])
+	assert.True(t, shared != copies[0])
+	for _, c := range copies {
+		assert.True(t, c == copies[0])
+	}
+
+	// The next execution makes its own copy.
+	time.Sleep(cacheTtl * 2)
+	c, _ := fnl.ExecuteAndCopyResult("opId", opExeFunc)
+	assert.True(t, c != copies[0])
+}
+
+func benchmarkExecuteAndCopyResult(b *testing.B, copyCache bool) {
+	fnl := New(WithCacheTtl(time.Hour), WithCopyCache(copyCache))
+	opExeFunc := func() (interface{}, error) {
+		return newCopied(), nil
+	}
+	fnl.Execute("opId", opExeFunc)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			fnl.ExecuteAndCopyResult("opId", opExeFunc)
+		}
+	})
+}
+
+func BenchmarkExecuteAndCopyResult(b *testing.B) {
+	benchmarkExecuteAndCopyResult(b, false)
+}
+
+func BenchmarkExecuteAndCopyResultWithCopyCache(b *testing.B) {
+	benchmarkExecuteAndCopyResult(b, true)
+}
+
+func TestWithCopyTimeout(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithCopyCache(true), WithCopyTimeout(time.Millisecond))
+
+	// Copying a deep graph of maps takes far longer than a millisecond.
+	expensive := make([]map[string]int, 500)
+	for i := range expensive {
+		expensive[i] = newCopied().Values
+	}
+	res, err := fnl.ExecuteAndCopyResult("expensive", func() (interface{}, error) {
+		return expensive, nil
+	})
+	assert.Nil(t, res)
+	assert.Equal(t, ErrCopyTimeout, err)
+
+	res, err = fnl.Execute("expensive", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expensive, res, "the result is still cached")
+
+	// The abandoned copy completes in the background and is shared with the later copy-callers.
+	assert.Eventually(t, func() bool {
+		res, err = fnl.ExecuteAndCopyResult("expensive", nil)
+		return err == nil
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, expensive, res)
+
+	res, err = fnl.ExecuteAndCopyResult("cheap", func() (interface{}, error) {
+		return &copied{Values: map[string]int{"a": 1}}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &copied{Values: map[string]int{"a": 1}}, res)
+}
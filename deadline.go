@@ -0,0 +1,65 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrAbandoned is the cause of the cancellation of the context of an execution whose waiters all gave up, see
+// WithCancelAbandoned and WithShrinkingDeadline.
+var ErrAbandoned = errors.New("All the waiters of the operation gave up before it completed")
+
+// countsWaiters reports whether the waiters of the operation are counted, so that the operation is abandoned once they
+// all gave up.
+func (op *operationInProcess) countsWaiters() bool {
+	return op.config.shrinkingDeadline || op.config.cancelAbandoned
+}
+
+// awaitCounted waits for the operation like await, counting the operation's waiters unless already counted.
+func (f *Funnel) awaitCounted(ctx context.Context, op *operationInProcess, timeout time.Duration, counted bool) (res interface{}, opErr error, deliveryErr error) {
+	if !counted {
+		f.Lock()
+		op.waiting++
+		f.Unlock()
+	}
+
+	res, opErr, deliveryErr = op.waitDetailed(ctx, timeout)
+	f.leave(op, deliveryErr == timeoutError)
+	return
+}
+
+// uncount removes a request counted by startOperation from the operation's waiters without waiting for the operation,
+// nor abandoning it.
+func (f *Funnel) uncount(op *operationInProcess) {
+	if op.countsWaiters() {
+		f.Lock()
+		op.waiting--
+		f.Unlock()
+	}
+}
+
+// leave is called once a waiter stopped waiting for the operation. Once no waiter remains, the execution of an
+// operation still in process is canceled, since nobody awaits its result.
+// With a shrinking deadline the operation is deleted as well: since each waiter leaves by its own deadline at the
+// latest, the operation's deadline is in effect the latest deadline of its remaining waiters. An operation the waiter
+// timed out on is left for the waiter to delete, as without a shrinking deadline. Since startOperation counts the
+// requests under the lock it found the operation with (see callConfig.awaits), no request is left waiting for an
+// operation deleted this way.
+func (f *Funnel) leave(op *operationInProcess, timedOut bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	op.waiting--
+	if op.waiting > 0 || op.completed.IsSet() {
+		return
+	}
+	abandoned := op.config.cancelAbandoned
+	if op.config.shrinkingDeadline && !timedOut && !op.deleted.IsSet() {
+		f.removeOperation(op)
+		abandoned = true
+	}
+	if abandoned && op.cancelExec != nil {
+		op.cancelExec(ErrAbandoned)
+	}
+}
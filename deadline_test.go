@@ -0,0 +1,201 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShrinkingDeadline(t *testing.T) {
+	fnl := New(WithTimeout(time.Minute), WithShrinkingDeadline(true))
+
+	canceled := make(chan error, 1)
+	opExeFunc := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		canceled <- context.Cause(ctx)
+		return nil, ctx.Err()
+	}
+	errs := make(chan error)
+	for _, timeout := range []time.Duration{time.Millisecond * 20, time.Millisecond * 40} {
+		go func(timeout time.Duration) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			_, err := fnl.ExecuteContext(ctx, "op", opExeFunc)
+			errs <- err
+		}(timeout)
+	}
+
+	// The first waiter leaving doesn't delete the operation, the second one does, well before the timeout.
+	assert.ErrorIs(t, <-errs, context.DeadlineExceeded)
+	assert.True(t, fnl.IsOpInProgress("op"))
+	assert.ErrorIs(t, <-errs, context.DeadlineExceeded)
+	assert.False(t, fnl.IsOpInProgress("op"))
+	assert.Equal(t, ErrAbandoned, <-canceled)
+}
+
+func TestShrinkingDeadlinePatientWaiter(t *testing.T) {
+	fnl := New(WithTimeout(time.Minute), WithShrinkingDeadline(true))
+
+	release := make(chan empty)
+	patient := fnl.Submit("op", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	done := make(chan empty)
+	go func() {
+		res, err := patient.Await(context.Background())
+		assert.Equal(t, 1, res)
+		assert.Nil(t, err)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&fnl.counters.waiters) == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err := fnl.ExecuteContext(ctx, "op", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("the operation is in process")
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The patient waiter remains, so the operation does too.
+	assert.True(t, fnl.IsOpInProgress("op"))
+	close(release)
+	<-done
+}
+
+func TestCancelAbandoned(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond*20), WithCancelAbandoned(true))
+
+	canceled := make(chan error, 1)
+	opExeFunc := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		canceled <- context.Cause(ctx)
+		return nil, ctx.Err()
+	}
+	errs := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := fnl.ExecuteContext(context.Background(), "timed out", opExeFunc)
+			errs <- err
+		}()
+	}
+	assert.Equal(t, timeoutError, <-errs)
+	assert.Equal(t, timeoutError, <-errs)
+	assert.Equal(t, ErrAbandoned, <-canceled)
+
+	// A request giving up on its context abandons the operation just the same.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := fnl.ExecuteContext(ctx, "canceled", opExeFunc)
+		errs <- err
+	}()
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("canceled") }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.Equal(t, ErrAbandoned, <-canceled)
+}
+
+func TestCancelAbandonedWaiterRemains(t *testing.T) {
+	fnl := New(WithCancelAbandoned(true))
+
+	release := make(chan empty)
+	opExeFunc := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "res", nil
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+	done := make(chan empty)
+	go func() {
+		res, err := fnl.ExecuteContext(context.Background(), "opId", opExeFunc)
+		assert.Equal(t, "res", res)
+		assert.Nil(t, err)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&fnl.counters.waiters) == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := fnl.ExecuteContext(ctx, "opId", opExeFunc)
+	assert.ErrorIs(t, err, context.Canceled)
+	close(release)
+	<-done
+}
+
+func TestCancelAbandonedJoiningWaiter(t *testing.T) {
+	fnl := New(WithCancelAbandoned(true))
+
+	release := make(chan empty)
+	opExeFunc := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "res", nil
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := fnl.ExecuteContext(ctx, "opId", opExeFunc)
+		errs <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&fnl.counters.waiters) == 1
+	}, time.Second, time.Millisecond)
+
+	// A request that joined the operation but doesn't wait for it yet is already counted, so the first waiter leaving
+	// doesn't abandon the operation.
+	op, started, err := fnl.startOperation("opId", callConfig{cost: 1, awaits: true}, nil)
+	assert.Nil(t, err)
+	assert.False(t, started)
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.Nil(t, context.Cause(op.execCtx))
+
+	close(release)
+	res, opErr, deliveryErr := fnl.await(context.Background(), op, op.config.timeout, true)
+	assert.Equal(t, "res", res)
+	assert.Nil(t, opErr)
+	assert.Nil(t, deliveryErr)
+}
+
+func TestShrinkingDeadlineJoiningWaiter(t *testing.T) {
+	fnl := New(WithTimeout(time.Minute), WithShrinkingDeadline(true))
+
+	release := make(chan empty)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := fnl.ExecuteContext(ctx, "opId", func(ctx context.Context) (interface{}, error) {
+			<-release
+			return "res", nil
+		})
+		errs <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&fnl.counters.waiters) == 1
+	}, time.Second, time.Millisecond)
+
+	// The first waiter leaving doesn't delete the operation joined by a request that doesn't wait for it yet.
+	op, _, err := fnl.startOperation("opId", callConfig{cost: 1, awaits: true}, nil)
+	assert.Nil(t, err)
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.True(t, fnl.IsOpInProgress("opId"))
+
+	close(release)
+	res, _, deliveryErr := fnl.await(context.Background(), op, op.config.timeout, true)
+	assert.Equal(t, "res", res)
+	assert.Nil(t, deliveryErr)
+}
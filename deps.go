@@ -0,0 +1,114 @@
+package funnel
+
+import "time"
+
+// ExecuteWithDeps is like Execute, but records that the operation depends on the operations identified by deps, so that
+// forgetting any of them (see Forget) forgets this operation as well. The dependencies are recorded only by the request
+// that starts the execution, and they are released once the operation is deleted from the funnel.
+func (f *Funnel) ExecuteWithDeps(operationId string, deps []string, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
+	return f.execute(operationId, callConfig{cost: 1, deps: deps}, opExeFunc)
+}
+
+// Forget deletes the operation from the funnel, whether its result is cached or it is still in process, so that the
+// next request for the same operation will re-execute it. Goroutines already waiting for an operation in process still
+// receive its result, even if its execution didn't start yet (see WithConcurrencyBudget), but the result is not cached.
+// The last good result kept for serving on panic is dropped as well. Operations which depend on the forgotten operation
+// (see ExecuteWithDeps) are forgotten as well, transitively. Forgetting an operation that doesn't exist does nothing.
+// With a backend (see WithBackend), the operation is forgotten by the other funnels sharing it as well, and with an
+// external cache (see WithCache), the results of the forgotten operations are deleted from it.
+func (f *Funnel) Forget(operationId string) {
+	operationId = f.key(operationId)
+
+	f.Lock()
+	forgotten := f.forget(operationId)
+	f.Unlock()
+
+	f.publishInvalidations(operationId)
+	f.deleteCached(forgotten)
+}
+
+// ForgetMatching forgets the cached results of all the operations whose identifier matches the predicate, as Forget does
+// for each of them (including their dependents), and returns the number of matching results forgotten. Operations still
+// in process are not affected. The predicate is called without holding the funnel's lock, on the cached results as of
+// the call; a result replaced meanwhile (e.g. expired and re-executed) is kept.
+func (f *Funnel) ForgetMatching(pred func(operationId string) bool) int {
+	f.Lock()
+	cached := make(map[string]*operationInProcess)
+	now := time.Now()
+	for id, op := range f.opInProcess {
+		if op.completed.IsSet() && op.cacheable && now.Before(op.expiresAt) {
+			cached[id] = op
+		}
+	}
+	f.Unlock()
+
+	for id := range cached {
+		if !pred(id) {
+			delete(cached, id)
+		}
+	}
+
+	f.Lock()
+	matching := make([]string, 0, len(cached))
+	var forgotten []string
+	for id, op := range cached {
+		if f.opInProcess[id] == op {
+			forgotten = append(forgotten, f.forget(id)...)
+			matching = append(matching, id)
+		}
+	}
+	f.Unlock()
+
+	f.publishInvalidations(matching...)
+	f.deleteCached(forgotten)
+	return len(matching)
+}
+
+// forget deletes the operation and its dependents, transitively, and returns the identifiers of the operation and of
+// its dependents. Must be called with the lock held.
+func (f *Funnel) forget(operationId string) (forgotten []string) {
+	visited := map[string]empty{operationId: {}}
+	queue := []string{operationId}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		forgotten = append(forgotten, id)
+
+		// The dependents are collected before removing the operation, since removing a dependent updates the index.
+		for dependent := range f.dependents[id] {
+			if _, found := visited[dependent]; !found {
+				visited[dependent] = empty{}
+				queue = append(queue, dependent)
+			}
+		}
+		if op, found := f.opInProcess[id]; found {
+			op.forgotten = true
+			f.removeOperation(op)
+		}
+		delete(f.lastGood, id)
+	}
+	return forgotten
+}
+
+// registerDeps adds the operation to the dependency index. Must be called with the lock held.
+func (f *Funnel) registerDeps(op *operationInProcess) {
+	for _, dep := range op.deps {
+		dependents, found := f.dependents[dep]
+		if !found {
+			dependents = make(map[string]empty)
+			f.dependents[dep] = dependents
+		}
+		dependents[op.operationId] = empty{}
+	}
+}
+
+// unregisterDeps removes the operation from the dependency index. Must be called with the lock held.
+func (f *Funnel) unregisterDeps(op *operationInProcess) {
+	for _, dep := range op.deps {
+		dependents := f.dependents[dep]
+		delete(dependents, op.operationId)
+		if len(dependents) == 0 {
+			delete(f.dependents, dep)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package funnel
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForgetCascadesToDependents(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	value := func(res string) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			return res, nil
+		}
+	}
+
+	// base <- derived <- derivedTwice, and a cycle between derived and cyclic.
+	fnl.Execute("base", value("base"))
+	fnl.ExecuteWithDeps("derived", []string{"base", "cyclic"}, value("derived"))
+	fnl.ExecuteWithDeps("derivedTwice", []string{"derived"}, value("derivedTwice"))
+	fnl.ExecuteWithDeps("cyclic", []string{"derived"}, value("cyclic"))
+	fnl.ExecuteWithDeps("unrelated", []string{"other"}, value("unrelated"))
+
+	fnl.Forget("base")
+
+	for _, id := range []string{"base", "derived", "derivedTwice", "cyclic"} {
+		assert.False(t, fnl.IsOpInProgress(id), id+" should have been forgotten")
+	}
+	assert.True(t, fnl.IsOpInProgress("unrelated"))
+	assert.Equal(t, map[string]map[string]empty{"other": {"unrelated": {}}}, fnl.dependents)
+
+	res, _ := fnl.Execute("derived", value("recomputed"))
+	assert.Equal(t, "recomputed", res)
+}
+
+func TestForgetInProcess(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	results := make(chan interface{})
+	go func() {
+		res, _ := fnl.Execute("opId", func() (interface{}, error) {
+			<-release
+			return "forgotten", nil
+		})
+		results <- res
+	}()
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+
+	fnl.Forget("opId")
+	fnl.Forget("nonexistent")
+
+	res, _ := fnl.Execute("opId", func() (interface{}, error) {
+		return "fresh", nil
+	})
+	assert.Equal(t, "fresh", res)
+
+	// The waiting goroutine still receives the result of the forgotten operation, which doesn't replace the fresh one.
+	close(release)
+	assert.Equal(t, "forgotten", <-results)
+	res, _ = fnl.Execute("opId", func() (interface{}, error) {
+		return "executed again", nil
+	})
+	assert.Equal(t, "fresh", res)
+}
+
+// An operation forgotten while waiting for the concurrency budget is still executed for its waiters.
+func TestForgetWaitingForBudget(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithConcurrencyBudget(1))
+
+	holding, release := make(chan empty), make(chan empty)
+	fnl.Submit("holder", func() (interface{}, error) {
+		close(holding)
+		<-release
+		return nil, nil
+	})
+	<-holding
+	forgotten := fnl.Submit("opId", func() (interface{}, error) {
+		return "forgotten", nil
+	})
+	fnl.Forget("opId")
+	fresh := fnl.Submit("opId", func() (interface{}, error) {
+		return "fresh", nil
+	})
+	close(release)
+
+	res, err := forgotten.Await(context.Background())
+	assert.Equal(t, "forgotten", res)
+	assert.Nil(t, err)
+	res, err = fresh.Await(context.Background())
+	assert.Equal(t, "fresh", res)
+	assert.Nil(t, err)
+	res, _ = fnl.Execute("opId", nil)
+	assert.Equal(t, "fresh", res)
+}
+
+// The caller's slice of dependencies may be reused once ExecuteWithDeps returns.
+func TestExecuteWithDepsCopiesDeps(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	deps := []string{"base"}
+	fnl.ExecuteWithDeps("derived", deps, func() (interface{}, error) {
+		return "derived", nil
+	})
+	deps[0] = "other"
+
+	fnl.Forget("derived")
+	assert.Empty(t, fnl.dependents)
+
+	// A re-created operation that declared no dependency is not forgotten with the former base.
+	fnl.Execute("derived", func() (interface{}, error) {
+		return "independent", nil
+	})
+	fnl.Forget("base")
+	assert.True(t, fnl.IsOpInProgress("derived"))
+}
+
+func TestForgetIfCascadesToDependents(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	fnl.Execute("base", func() (interface{}, error) {
+		return "stale", nil
+	})
+	fnl.ExecuteWithDeps("derived", []string{"base"}, func() (interface{}, error) {
+		return "derived", nil
+	})
+
+	assert.True(t, fnl.ForgetIf("base", func(res interface{}, err error) bool {
+		return res == "stale"
+	}))
+	assert.False(t, fnl.IsOpInProgress("derived"))
+}
+
+// An execution that completes after its operation was deleted still releases the goroutines waiting for it.
+func TestDeletedOperationReleasesWaiters(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	results := make(chan interface{}, 1)
+	go func() {
+		res, _ := fnl.Execute("opId", func() (interface{}, error) {
+			<-release
+			return "result", nil
+		})
+		results <- res
+	}()
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+
+	fnl.Forget("opId")
+	close(release)
+
+	select {
+	case res := <-results:
+		assert.Equal(t, "result", res)
+	case <-time.After(time.Second):
+		t.Fatal("The waiting goroutine should have been released when the deleted operation completed")
+	}
+	assert.False(t, fnl.IsOpInProgress("opId"))
+}
+
+// A panic of an execution that completes after its operation was deleted is recovered and doesn't crash the process.
+func TestDeletedOperationPanicIsRecovered(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond * 20))
+
+	panicked := make(chan empty)
+	_, err := fnl.Execute("opId", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 50)
+		defer close(panicked)
+		panic("test ends with panic")
+	})
+	assert.Equal(t, timeoutError, err)
+
+	<-panicked
+	time.Sleep(time.Millisecond * 10)
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return "recreated", nil
+	})
+	assert.Equal(t, "recreated", res)
+	assert.Nil(t, err)
+}
+
+// Deleted operations must not be referenced by the funnel anymore, including its auxiliary indexes and expiry timers.
+// The finalizer is set on the result, which is referenced only by its operation, because an operation is part of a
+// reference cycle (with its expiry timer) and finalizers don't run on such cycles.
+func TestDeletedOperationsAreCollected(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	type result struct {
+		payload []byte
+	}
+	var numOfCollected int64
+	numOfCycles := 100
+	for i := 0; i < numOfCycles; i++ {
+		fnl.ExecuteWithDeps("derived", []string{"base"}, func() (interface{}, error) {
+			res := &result{payload: make([]byte, 1024)}
+			runtime.SetFinalizer(res, func(*result) {
+				atomic.AddInt64(&numOfCollected, 1)
+			})
+			return res, nil
+		})
+		fnl.Forget("base")
+	}
+
+	assert.Eventually(t, func() bool {
+		runtime.GC()
+		return atomic.LoadInt64(&numOfCollected) == int64(numOfCycles)
+	}, time.Second*5, time.Millisecond*10, "Expected all the deleted operations to be garbage collected")
+	assert.Empty(t, fnl.opInProcess)
+	assert.Empty(t, fnl.dependents)
+}
+
+func TestForgetMatching(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	opExeFunc := func() (interface{}, error) { return nil, nil }
+	for _, id := range []string{"tenant-42/a", "tenant-42/b", "tenant-7/a"} {
+		fnl.Execute(id, opExeFunc)
+	}
+	fnl.ExecuteWithDeps("report", []string{"tenant-42/a"}, opExeFunc)
+
+	release := make(chan empty)
+	defer close(release)
+	go fnl.Execute("tenant-42/in-process", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("tenant-42/in-process") }, time.Second, time.Millisecond)
+
+	numOfForgotten := fnl.ForgetMatching(func(operationId string) bool {
+		return strings.HasPrefix(operationId, "tenant-42/")
+	})
+	assert.Equal(t, 2, numOfForgotten)
+	assert.False(t, fnl.IsOpInProgress("tenant-42/a"))
+	assert.False(t, fnl.IsOpInProgress("tenant-42/b"))
+	assert.False(t, fnl.IsOpInProgress("report"), "dependents are forgotten as well")
+	assert.True(t, fnl.IsOpInProgress("tenant-7/a"))
+	assert.True(t, fnl.IsOpInProgress("tenant-42/in-process"))
+}
@@ -0,0 +1,55 @@
+package funnel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteDetailed(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond * 20))
+
+	res, opErr, deliveryErr := fnl.ExecuteDetailed("ok", func() (interface{}, error) {
+		return "res", nil
+	})
+	assert.Equal(t, "res", res)
+	assert.Nil(t, opErr)
+	assert.Nil(t, deliveryErr)
+
+	failure := errors.New("operation error")
+	res, opErr, deliveryErr = fnl.ExecuteDetailed("failed", func() (interface{}, error) {
+		return "partial", failure
+	})
+	assert.Equal(t, "partial", res)
+	assert.Equal(t, failure, opErr)
+	assert.Nil(t, deliveryErr)
+
+	release := make(chan empty)
+	defer close(release)
+	res, opErr, deliveryErr = fnl.ExecuteDetailed("slow", func() (interface{}, error) {
+		<-release
+		return "res", failure
+	})
+	assert.Nil(t, res)
+	assert.Nil(t, opErr)
+	assert.Equal(t, timeoutError, deliveryErr)
+}
+
+func TestExecuteDetailedNestedTimeout(t *testing.T) {
+	inner := New(WithTimeout(time.Millisecond * 10))
+	outer := New()
+
+	// The timeout of the inner funnel is the outer operation's own error, not a failure to deliver its result.
+	release := make(chan empty)
+	defer close(release)
+	_, opErr, deliveryErr := outer.ExecuteDetailed("opId", func() (interface{}, error) {
+		return inner.Execute("opId", func() (interface{}, error) {
+			<-release
+			return nil, nil
+		})
+	})
+	assert.Equal(t, timeoutError, opErr)
+	assert.Nil(t, deliveryErr)
+}
@@ -0,0 +1,103 @@
+package funnel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// waiterMemory is the estimated memory, in bytes, held on behalf of the funnel by each goroutine waiting for an
+// operation: its timer and what the wait allocates. Waiters share the operation's done channel, so this overhead doesn't
+// depend on the number of waiters of an operation. The stack of the waiting goroutine, which belongs to the caller, is not counted.
+const waiterMemory = 512
+
+// Dump is a snapshot of the funnel's state for inspection and capacity planning, as returned by Funnel.Dump.
+type Dump struct {
+	// The number of operations held by the funnel, whether in process or cached.
+	Operations int
+
+	// The number of goroutines currently waiting for an operation.
+	Waiters int
+
+	// WaiterMemory estimates the memory held by the waiting goroutines, in bytes, at the upper bound of 512 bytes per waiter.
+	WaiterMemory int
+
+	// ResultBytes is the total estimated size of the cached results, and ResultSizes the size of each of them by
+	// operation identifier, as estimated by the size function (see WithSizeFunc). Both are empty without a size function.
+	ResultBytes int
+	ResultSizes map[string]int
+}
+
+// Dump returns a snapshot of the funnel's state.
+func (f *Funnel) Dump() Dump {
+	waiters := int(atomic.LoadInt64(&f.counters.waiters))
+	dump := Dump{
+		Waiters:      waiters,
+		WaiterMemory: waiters * waiterMemory,
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	dump.Operations = len(f.opInProcess)
+	if f.currentConfig().sizeFunc != nil {
+		dump.ResultBytes = f.resultBytes
+		dump.ResultSizes = make(map[string]int)
+		for id, op := range f.opInProcess {
+			if !op.expiresAt.IsZero() {
+				dump.ResultSizes[id] = op.size
+			}
+		}
+	}
+	return dump
+}
+
+// InFlightDurations returns how long each operation in process has been executing so far, in no particular order, e.g.
+// for alerting on a cluster of long running operations that indicates the degradation of an upstream. Cached results
+// are not counted, nor the operations that ended with panic or the concurrent executions the funnel doesn't hold (see
+// WithPerKeyConcurrency).
+func (f *Funnel) InFlightDurations() []time.Duration {
+	f.Lock()
+	defer f.Unlock()
+
+	now := time.Now()
+	durations := make([]time.Duration, 0, len(f.opInProcess))
+	for _, op := range f.opInProcess {
+		if op.inProcess() {
+			durations = append(durations, now.Sub(op.startTime))
+		}
+	}
+	return durations
+}
+
+// Range calls fn for each operation held by the funnel, in no particular order, until fn returns false. For a cached
+// result, fn receives its result and error with completed set; for an operation in process, it receives neither.
+// Range iterates over a snapshot of the operations taken under the funnel's lock, so fn is called without holding it
+// and may call the funnel: operations added or deleted meanwhile are not reflected, and an operation visited as in
+// process may have completed by the time fn is called. Expired results and the operations that ended with panic are not
+// visited.
+func (f *Funnel) Range(fn func(id string, res interface{}, err error, completed bool) bool) {
+	type entry struct {
+		id        string
+		res       interface{}
+		err       error
+		completed bool
+	}
+
+	f.Lock()
+	now := time.Now()
+	entries := make([]entry, 0, len(f.opInProcess))
+	for id, op := range f.opInProcess {
+		if op.inProcess() || (op.completed.IsSet() && !op.cacheable) {
+			entries = append(entries, entry{id: id})
+		} else if op.completed.IsSet() && now.Before(op.expiresAt) {
+			entries = append(entries, entry{id, op.res, op.err, true})
+		}
+	}
+	f.Unlock()
+
+	for _, e := range entries {
+		if !fn(e.id, e.res, e.err, e.completed) {
+			return
+		}
+	}
+}
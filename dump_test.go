@@ -0,0 +1,167 @@
+package funnel
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// heapWhileBlocked returns the growth of the heap once numOfGoroutines goroutines are blocked in block, as reported by ready.
+func heapWhileBlocked(numOfGoroutines int, block func(), ready func() bool) uint64 {
+	var before, blocked runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	for i := 0; i < numOfGoroutines; i++ {
+		go block()
+	}
+	for !ready() {
+		time.Sleep(time.Millisecond)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&blocked)
+	if blocked.HeapAlloc < before.HeapAlloc {
+		return 0
+	}
+	return blocked.HeapAlloc - before.HeapAlloc
+}
+
+func TestDumpWaiters(t *testing.T) {
+	fnl := New()
+	release := make(chan empty)
+	opExeFunc := func() (interface{}, error) {
+		<-release
+		return nil, nil
+	}
+
+	numOfWaiters := 2000
+	var done sync.WaitGroup
+	done.Add(numOfWaiters * 2)
+
+	// The same goroutines, blocked without the funnel, make the baseline.
+	var numOfBlocked int32
+	baseline := heapWhileBlocked(numOfWaiters, func() {
+		defer done.Done()
+		atomic.AddInt32(&numOfBlocked, 1)
+		<-release
+	}, func() bool { return atomic.LoadInt32(&numOfBlocked) == int32(numOfWaiters) })
+
+	waiting := heapWhileBlocked(numOfWaiters, func() {
+		defer done.Done()
+		fnl.Execute("opId", opExeFunc)
+	}, func() bool { return fnl.Dump().Waiters == numOfWaiters })
+
+	dump := fnl.Dump()
+	assert.Equal(t, 1, dump.Operations)
+	assert.Equal(t, numOfWaiters, dump.Waiters)
+	assert.Equal(t, numOfWaiters*waiterMemory, dump.WaiterMemory)
+
+	var overhead uint64
+	if waiting > baseline {
+		overhead = (waiting - baseline) / uint64(numOfWaiters)
+	}
+	assert.True(t, overhead <= waiterMemory, "per-waiter overhead of %d bytes exceeds %d", overhead, waiterMemory)
+
+	close(release)
+	done.Wait()
+	assert.Equal(t, 0, fnl.Dump().Waiters)
+}
+
+func TestDumpResultSizes(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithSizeFunc(func(res interface{}) int {
+		return len(res.(string))
+	}))
+	for _, res := range []string{"a", "bb", "cccc"} {
+		res := res
+		fnl.Execute(res, func() (interface{}, error) { return res, nil })
+	}
+
+	dump := fnl.Dump()
+	assert.Equal(t, 7, dump.ResultBytes)
+	assert.Equal(t, map[string]int{"a": 1, "bb": 2, "cccc": 4}, dump.ResultSizes)
+
+	fnl.Forget("cccc")
+	dump = fnl.Dump()
+	assert.Equal(t, 3, dump.ResultBytes)
+	assert.Equal(t, map[string]int{"a": 1, "bb": 2}, dump.ResultSizes)
+
+	// Without a size function no size is reported.
+	assert.Nil(t, New().Dump().ResultSizes)
+}
+
+func TestInFlightDurations(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Minute))
+	fnl.Execute("cached", func() (interface{}, error) {
+		return nil, nil
+	})
+	assert.Panics(t, func() {
+		fnl.Execute("panicked", func() (interface{}, error) { panic("test ends with panic") })
+	})
+	assert.Empty(t, fnl.InFlightDurations())
+
+	release := make(chan empty)
+	defer close(release)
+	opExeFunc := func() (interface{}, error) {
+		<-release
+		return nil, nil
+	}
+	fnl.Submit("long", opExeFunc)
+	time.Sleep(time.Millisecond * 50)
+	fnl.Submit("short", opExeFunc)
+
+	durations := fnl.InFlightDurations()
+	assert.Len(t, durations, 2)
+	if durations[0] < durations[1] {
+		durations[0], durations[1] = durations[1], durations[0]
+	}
+	assert.GreaterOrEqual(t, durations[0], time.Millisecond*50)
+	assert.Less(t, durations[1], time.Millisecond*50)
+}
+
+func TestRange(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	opErr := errors.New("failed")
+	fnl.Execute("succeeded", func() (interface{}, error) { return "res", nil })
+	fnl.Execute("failed", func() (interface{}, error) { return nil, opErr })
+	assert.Panics(t, func() {
+		fnl.Execute("panicked", func() (interface{}, error) { panic("test ends with panic") })
+	})
+
+	release := make(chan empty)
+	defer close(release)
+	go fnl.Execute("in-process", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("in-process") }, time.Second, time.Millisecond)
+
+	type entry struct {
+		res       interface{}
+		err       error
+		completed bool
+	}
+	visited := map[string]entry{}
+	fnl.Range(func(id string, res interface{}, err error, completed bool) bool {
+		// The funnel's lock is not held while visiting.
+		fnl.IsOpInProgress(id)
+		visited[id] = entry{res, err, completed}
+		return true
+	})
+	assert.Equal(t, map[string]entry{
+		"succeeded":  {"res", nil, true},
+		"failed":     {nil, opErr, true},
+		"in-process": {nil, nil, false},
+	}, visited)
+
+	numOfVisited := 0
+	fnl.Range(func(string, interface{}, error, bool) bool {
+		numOfVisited++
+		return numOfVisited < 2
+	})
+	assert.Equal(t, 2, numOfVisited)
+}
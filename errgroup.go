@@ -0,0 +1,16 @@
+package funnel
+
+import "golang.org/x/sync/errgroup"
+
+// Go schedules a request for the operation on the errgroup, as Execute would perform it, storing the result into the
+// provided pointer and returning the error to the group. into is written only once the request returned, so it may be
+// read once the group's Wait returned, and it may be nil when only the error matters.
+func (f *Funnel) Go(g *errgroup.Group, operationId string, opExeFunc func() (interface{}, error), into *interface{}) {
+	g.Go(func() error {
+		res, err := f.Execute(operationId, opExeFunc)
+		if into != nil {
+			*into = res
+		}
+		return err
+	})
+}
@@ -0,0 +1,43 @@
+package funnel
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestGo(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	var numOfExecutions int32
+	value := func(i int) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			atomic.AddInt32(&numOfExecutions, 1)
+			time.Sleep(time.Millisecond * 10)
+			return i, nil
+		}
+	}
+
+	var g errgroup.Group
+	results := make([]interface{}, 6)
+	for i := range results {
+		// Pairs of requests for the same operation are coalesced.
+		fnl.Go(&g, strconv.Itoa(i/2), value(i/2), &results[i])
+	}
+	assert.Nil(t, g.Wait())
+	assert.Equal(t, []interface{}{0, 0, 1, 1, 2, 2}, results)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&numOfExecutions))
+
+	var failing errgroup.Group
+	opErr := errors.New("operation error")
+	var res interface{}
+	fnl.Go(&failing, "ok", value(1), &res)
+	fnl.Go(&failing, "failing", func() (interface{}, error) { return nil, opErr }, nil)
+	assert.Equal(t, opErr, failing.Wait())
+	assert.Equal(t, 1, res)
+}
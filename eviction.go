@@ -0,0 +1,149 @@
+package funnel
+
+import (
+	"container/list"
+	"hash/fnv"
+)
+
+// EvictionPolicy selects which cached result is evicted when the number of cached results exceeds the maximum
+// (see WithMaxEntries and WithEvictionPolicy).
+type EvictionPolicy int
+
+const (
+	// PolicyLRU evicts the least recently used result.
+	PolicyLRU EvictionPolicy = iota
+
+	// PolicyLFU retains frequently requested results: a newly cached result replaces the least recently used one only
+	// if its operation was requested more frequently, otherwise the new result is evicted right away. Frequencies are
+	// estimated over the recent requests, including the ones for operations that are not cached.
+	PolicyLFU
+)
+
+// String returns the name of the policy.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "LRU"
+	case PolicyLFU:
+		return "LFU"
+	}
+	return "Unknown"
+}
+
+// evictor bounds the number of cached results. It is not safe for concurrent use, the funnel's lock guards it.
+type evictor struct {
+	policy     EvictionPolicy
+	maxEntries int
+
+	// recency holds the cached operations, the front being the most recently used.
+	recency *list.List
+
+	// frequency estimates how frequently each operation is requested, nil unless the policy is PolicyLFU.
+	frequency *frequencySketch
+}
+
+func newEvictor(policy EvictionPolicy, maxEntries int) *evictor {
+	e := &evictor{policy: policy, maxEntries: maxEntries, recency: list.New()}
+	if policy == PolicyLFU {
+		e.frequency = newFrequencySketch(maxEntries)
+	}
+	return e
+}
+
+// requested records a request for the operation, found in the funnel or not.
+func (e *evictor) requested(operationId string, op *operationInProcess) {
+	if e.frequency != nil {
+		e.frequency.increment(operationId)
+	}
+	if op != nil && op.evictElem != nil {
+		e.recency.MoveToFront(op.evictElem)
+	}
+}
+
+// cached adds the operation whose result was just cached, and returns the operation to evict, if any.
+func (e *evictor) cached(op *operationInProcess) (victim *operationInProcess) {
+	op.evictElem = e.recency.PushFront(op)
+	if e.recency.Len() <= e.maxEntries {
+		return nil
+	}
+
+	victim = e.recency.Back().Value.(*operationInProcess)
+	if e.frequency != nil && e.frequency.estimate(op.operationId) <= e.frequency.estimate(victim.operationId) {
+		return op
+	}
+	return victim
+}
+
+// removed drops the operation, once it's deleted from the funnel.
+func (e *evictor) removed(op *operationInProcess) {
+	if op.evictElem != nil {
+		e.recency.Remove(op.evictElem)
+		op.evictElem = nil
+	}
+}
+
+// sketchDepth is the number of counters per operation in the frequency sketch.
+const sketchDepth = 4
+
+// frequencySketch is a count-min sketch of 4-bit counters estimating the number of recent requests per operation.
+// All the counters are halved once the number of requests recorded reaches the sample size, so that frequencies reflect
+// the recent requests only.
+type frequencySketch struct {
+	counters   [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newFrequencySketch(maxEntries int) *frequencySketch {
+	width := 64
+	for width < maxEntries*8 {
+		width *= 2
+	}
+
+	s := &frequencySketch{mask: uint64(width - 1), sampleSize: width * 10}
+	for i := range s.counters {
+		s.counters[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// indexes returns the index of the operation's counter in each row.
+func (s *frequencySketch) indexes(operationId string) (indexes [sketchDepth]uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(operationId))
+	sum := h.Sum64()
+	h1, h2 := sum, sum>>32|sum<<32
+	for i := range indexes {
+		indexes[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return indexes
+}
+
+func (s *frequencySketch) increment(operationId string) {
+	for i, index := range s.indexes(operationId) {
+		if s.counters[i][index] < 15 {
+			s.counters[i][index]++
+		}
+	}
+
+	s.additions++
+	if s.additions == s.sampleSize {
+		for i := range s.counters {
+			for j := range s.counters[i] {
+				s.counters[i][j] /= 2
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(operationId string) uint8 {
+	min := uint8(15)
+	for i, index := range s.indexes(operationId) {
+		if s.counters[i][index] < min {
+			min = s.counters[i][index]
+		}
+	}
+	return min
+}
@@ -0,0 +1,85 @@
+package funnel
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hitRate returns the ratio of the requests served from the cache, for a skewed sequence of requests.
+func hitRate(policy EvictionPolicy) float64 {
+	fnl := New(WithCacheTtl(time.Hour), WithMaxEntries(10), WithEvictionPolicy(policy))
+
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 200)
+	numOfRequests, numOfExecutions := 5000, 0
+	for i := 0; i < numOfRequests; i++ {
+		fnl.Execute(strconv.FormatUint(zipf.Uint64(), 10), func() (interface{}, error) {
+			numOfExecutions++
+			return nil, nil
+		})
+	}
+	return 1 - float64(numOfExecutions)/float64(numOfRequests)
+}
+
+func TestEvictionPolicyHitRate(t *testing.T) {
+	lru, lfu := hitRate(PolicyLRU), hitRate(PolicyLFU)
+	t.Logf("hit rate LRU %.3f LFU %.3f", lru, lfu)
+	assert.True(t, lfu > lru, "LFU hit rate %.3f should exceed LRU hit rate %.3f", lfu, lru)
+}
+
+func TestWithMaxEntriesLRU(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithMaxEntries(2))
+	opExeFunc := func() (interface{}, error) { return nil, nil }
+
+	fnl.Execute("a", opExeFunc)
+	fnl.Execute("b", opExeFunc)
+	fnl.Execute("a", opExeFunc) // "b" is now the least recently used.
+	fnl.Execute("c", opExeFunc)
+
+	assert.True(t, fnl.IsOpInProgress("a"))
+	assert.False(t, fnl.IsOpInProgress("b"))
+	assert.True(t, fnl.IsOpInProgress("c"))
+	assert.Equal(t, 2, fnl.evictor.recency.Len())
+
+	fnl.Forget("a")
+	assert.Equal(t, 1, fnl.evictor.recency.Len())
+}
+
+func TestWithMaxEntriesLFURetainsFrequent(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithMaxEntries(1), WithEvictionPolicy(PolicyLFU))
+	opExeFunc := func() (interface{}, error) { return nil, nil }
+
+	for i := 0; i < 5; i++ {
+		fnl.Execute("hot", opExeFunc)
+	}
+	// A one-off request doesn't replace the frequently requested result, but is still served.
+	res, err := fnl.Execute("cold", func() (interface{}, error) { return "cold", nil })
+	assert.Equal(t, "cold", res)
+	assert.Nil(t, err)
+	assert.True(t, fnl.IsOpInProgress("hot"))
+	assert.False(t, fnl.IsOpInProgress("cold"))
+}
+
+// The number of operations held by the funnel stays bounded under a flood of unique identifiers.
+func BenchmarkMaxEntriesUniqueIds(b *testing.B) {
+	maxEntries := 1000
+	fnl := New(WithCacheTtl(time.Hour), WithMaxEntries(maxEntries))
+	opExeFunc := func() (interface{}, error) {
+		return nil, nil
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fnl.Execute(strconv.Itoa(i), opExeFunc)
+	}
+	b.StopTimer()
+
+	numOfEntries := fnl.Stats().TotalKeys
+	b.ReportMetric(float64(numOfEntries), "entries")
+	if numOfEntries > maxEntries {
+		b.Fatalf("%d operations are held, beyond the maximum of %d", numOfEntries, maxEntries)
+	}
+}
@@ -0,0 +1,94 @@
+package funnel
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryHeap orders the cached operations by the expiry of their results, the earliest first. The funnel's lock guards it.
+type expiryHeap []*operationInProcess
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].expiryIndex = i
+	h[j].expiryIndex = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	op := x.(*operationInProcess)
+	op.expiryIndex = len(*h)
+	*h = append(*h, op)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	op := old[len(old)-1]
+	old[len(old)-1] = nil // The operation can be collected once deleted.
+	*h = old[:len(old)-1]
+	op.expiryIndex = -1
+	return op
+}
+
+// scheduleExpiry queues the cached operation for deletion once its result expired. A single timer fires at the earliest
+// expiry, rather than one per cached result. Must be called with the lock held.
+func (f *Funnel) scheduleExpiry(op *operationInProcess) {
+	heap.Push(&f.expiries, op)
+	if op.expiryIndex != 0 {
+		return
+	}
+
+	// The operation expires first.
+	if f.isClosed() {
+		return
+	}
+	if f.expiryTimer == nil {
+		f.expiryTimer = time.AfterFunc(time.Until(op.expiresAt), f.expire)
+	} else {
+		f.expiryTimer.Reset(time.Until(op.expiresAt))
+	}
+}
+
+// unscheduleExpiry removes the operation from the expiry queue, if queued. Must be called with the lock held.
+func (f *Funnel) unscheduleExpiry(op *operationInProcess) {
+	if i := op.expiryIndex; i >= 0 && i < len(f.expiries) && f.expiries[i] == op {
+		heap.Remove(&f.expiries, i)
+	}
+}
+
+// expire deletes the operations whose result expired, and sets the timer for the next expiry. The lock is held only
+// while collecting the expired operations, and each of them is then deleted like on a timeout.
+func (f *Funnel) expire() {
+	f.Lock()
+	now := time.Now()
+	var expired []*operationInProcess
+	for len(f.expiries) > 0 && !now.Before(f.expiries[0].expiresAt) {
+		expired = append(expired, f.expiries[0])
+		heap.Pop(&f.expiries)
+	}
+	if len(f.expiries) > 0 && !f.isClosed() {
+		f.expiryTimer.Reset(time.Until(f.expiries[0].expiresAt))
+	}
+	f.Unlock()
+
+	for _, op := range expired {
+		f.deleteOperation(op)
+	}
+}
+
+// touch extends the lifetime of the cached result served to a request, if the result slides (see WithSlidingCacheTtl).
+// The expiry timer is left as is: when it fires before the new expiry, it's set again for the earliest one.
+// Must be called with the lock held.
+func (f *Funnel) touch(op *operationInProcess) {
+	if !op.sliding || !op.completed.IsSet() || f.opInProcess[op.operationId] != op {
+		return // A stale result served during its refresh doesn't slide, see WithStaleWhileRevalidate.
+	}
+	op.expiresAt = time.Now().Add(op.config.slidingCacheTtl)
+	if !op.freshUntil.IsZero() {
+		op.freshUntil = op.expiresAt
+		op.expiresAt = op.expiresAt.Add(op.config.staleWhileRevalidate)
+	}
+	f.unscheduleExpiry(op)
+	heap.Push(&f.expiries, op)
+}
@@ -0,0 +1,153 @@
+package funnel
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiryQueue(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Millisecond*400), WithNegativeCacheTtl(time.Millisecond*200))
+
+	for i := 0; i < 100; i++ {
+		fnl.Execute("res"+strconv.Itoa(i), func() (interface{}, error) {
+			return i, nil
+		})
+		fnl.Execute("err"+strconv.Itoa(i), func() (interface{}, error) {
+			return nil, errors.New("failed")
+		})
+	}
+	fnl.Lock()
+	assert.Len(t, fnl.expiries, 200)
+	fnl.Unlock()
+
+	// The errors expire first, then the results, with a single timer.
+	assert.Eventually(t, func() bool { return fnl.Dump().Operations == 100 }, time.Second, time.Millisecond)
+	for i := 0; i < 100; i++ {
+		assert.True(t, fnl.IsOpInProgress("res"+strconv.Itoa(i)))
+	}
+	assert.Eventually(t, func() bool { return fnl.Dump().Operations == 0 }, time.Second, time.Millisecond)
+	fnl.Lock()
+	assert.Empty(t, fnl.expiries)
+	fnl.Unlock()
+}
+
+func TestExpiryQueueDeletedEarly(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	for i := 0; i < 10; i++ {
+		fnl.Execute(strconv.Itoa(i), func() (interface{}, error) {
+			return i, nil
+		})
+	}
+	fnl.Forget("0")
+	fnl.Forget("5")
+
+	fnl.Lock()
+	defer fnl.Unlock()
+	assert.Len(t, fnl.expiries, 8)
+	for i, op := range fnl.expiries {
+		assert.Equal(t, i, op.expiryIndex)
+		assert.NotContains(t, []string{"0", "5"}, op.operationId)
+	}
+}
+
+func TestExpiryStoppedByClose(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Millisecond * 10))
+	fnl.Execute("opId", func() (interface{}, error) {
+		return "res", nil
+	})
+	fnl.Close()
+
+	// The expired result is kept, but not served.
+	time.Sleep(time.Millisecond * 30)
+	assert.Equal(t, 1, fnl.Dump().Operations)
+	assert.False(t, fnl.IsOpInProgress("opId"))
+}
+
+func TestSlidingCacheTtl(t *testing.T) {
+	fnl := New(WithSlidingCacheTtl(time.Millisecond * 100))
+
+	var numOfExecutions int64
+	opExeFunc := func() (interface{}, error) {
+		numOfExecutions++
+		return numOfExecutions, nil
+	}
+	fnl.Execute("accessed", opExeFunc)
+	fnl.Execute("idle", opExeFunc)
+
+	// Each access extends the lifetime of the accessed result, past its time-to-live since completion.
+	for i := 0; i < 6; i++ {
+		time.Sleep(time.Millisecond * 40)
+		res, _ := fnl.Execute("accessed", opExeFunc)
+		assert.Equal(t, int64(1), res)
+	}
+	assert.False(t, fnl.IsOpInProgress("idle"))
+
+	assert.Eventually(t, func() bool { return !fnl.IsOpInProgress("accessed") }, time.Second, time.Millisecond)
+	fnl.Lock()
+	assert.Empty(t, fnl.expiries)
+	fnl.Unlock()
+}
+
+func TestSlidingCacheTtlExclusive(t *testing.T) {
+	assert.Panics(t, func() { New(WithCacheTtl(time.Second), WithSlidingCacheTtl(time.Second)) })
+	assert.Panics(t, func() { NewConfig(WithSlidingCacheTtl(-time.Second)) })
+}
+
+func TestCacheTtlJitter(t *testing.T) {
+	ttl := time.Hour
+	fnl := New(WithCacheTtl(ttl), WithCacheTtlJitter(0.25))
+
+	before := time.Now()
+	for i := 0; i < 100; i++ {
+		fnl.Execute(strconv.Itoa(i), func() (interface{}, error) {
+			return i, nil
+		})
+	}
+	after := time.Now()
+
+	fnl.Lock()
+	defer fnl.Unlock()
+	expiries := make(map[time.Time]empty)
+	for _, op := range fnl.opInProcess {
+		assert.False(t, op.expiresAt.Before(before.Add(ttl*3/4)))
+		assert.False(t, op.expiresAt.After(after.Add(ttl*5/4)))
+		expiries[op.expiresAt] = empty{}
+	}
+	assert.Greater(t, len(expiries), 90, "the results should expire at random times")
+}
+
+func TestCacheTtlJitterRejected(t *testing.T) {
+	assert.Panics(t, func() { NewConfig(WithCacheTtlJitter(-0.1)) })
+	assert.Panics(t, func() { NewConfig(WithCacheTtlJitter(1.5)) })
+	assert.NotPanics(t, func() { NewConfig(WithCacheTtlJitter(1)) })
+}
+
+func TestWithTtlFunc(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithTtlFunc(func(res interface{}, err error) time.Duration {
+		if err != nil {
+			return 0
+		}
+		return res.(time.Duration)
+	}))
+
+	for _, ttl := range []time.Duration{time.Millisecond * 50, time.Millisecond * 150, time.Hour} {
+		fnl.Execute(ttl.String(), func() (interface{}, error) {
+			return ttl, nil
+		})
+	}
+	fnl.Execute("failed", func() (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	assert.False(t, fnl.IsOpInProgress("failed"), "a time-to-live of 0 prohibits caching")
+
+	// Each result expires after the time-to-live it carries.
+	assert.Eventually(t, func() bool { return !fnl.IsOpInProgress("50ms") }, time.Second, time.Millisecond)
+	assert.True(t, fnl.IsOpInProgress("150ms"))
+	assert.Eventually(t, func() bool { return !fnl.IsOpInProgress("150ms") }, time.Second, time.Millisecond)
+	assert.True(t, fnl.IsOpInProgress("1h0m0s"))
+}
@@ -0,0 +1,22 @@
+package funnel
+
+import "expvar"
+
+// publishExpvar publishes the funnel's counters under the name, see WithExpvar.
+func (f *Funnel) publishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		stats := f.Stats()
+		return map[string]interface{}{
+			"executions":       stats.Executions,
+			"coalesced":        stats.Coalesced,
+			"cacheHits":        stats.CacheHits,
+			"timeouts":         stats.Timeouts,
+			"panics":           stats.Panics,
+			"timeoutDeletions": stats.TimeoutDeletions,
+			"nearMisses":       stats.NearMisses,
+			"inFlight":         stats.InFlight,
+			"cached":           stats.Cached,
+			"size":             stats.TotalKeys,
+		}
+	}))
+}
@@ -0,0 +1,36 @@
+package funnel
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithExpvar(t *testing.T) {
+	name := "funnel-test-" + strconv.FormatInt(time.Now().UnixNano(), 10) // Unique across repeated runs.
+	fnl := New(WithCacheTtl(time.Hour), WithTimeout(time.Millisecond*20), WithExpvar(name))
+
+	fnl.Execute("opId", func() (interface{}, error) { return nil, nil })
+	fnl.Execute("opId", nil)
+	fnl.Execute("slow", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 50)
+		return nil, nil
+	})
+	assert.Panics(t, func() {
+		fnl.Execute("panicked", func() (interface{}, error) { panic("test ends with panic") })
+	})
+
+	var published map[string]int
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &published))
+	assert.Equal(t, 3, published["executions"])
+	assert.Equal(t, 1, published["cacheHits"])
+	assert.Equal(t, 1, published["timeouts"])
+	assert.Equal(t, 1, published["panics"])
+	assert.Equal(t, 2, published["size"])
+
+	assert.Panics(t, func() { New(WithExpvar(name)) }, "a name can be published once")
+}
@@ -0,0 +1,33 @@
+package funnel
+
+import "time"
+
+// flushPeriodically deletes all the cached results every interval, until the funnel is closed, see
+// WithGlobalFlushInterval.
+func (f *Funnel) flushPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.flush()
+		case <-f.closed:
+			return
+		}
+	}
+}
+
+// flush deletes all the cached results, and the last good results kept for serving on panic. The operations in process
+// are not affected.
+func (f *Funnel) flush() {
+	f.Lock()
+	defer f.Unlock()
+
+	for _, op := range f.opInProcess {
+		if op.completed.IsSet() {
+			f.removeOperation(op)
+		}
+	}
+	f.lastGood = make(map[string]opResult)
+}
@@ -0,0 +1,64 @@
+package funnel
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithGlobalFlushInterval(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithGlobalFlushInterval(time.Millisecond*50))
+	defer fnl.Close()
+
+	release := make(chan empty)
+	inProcess := fnl.Submit("in process", func() (interface{}, error) {
+		<-release
+		return "res", nil
+	})
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 3; i++ {
+			fnl.Execute(strconv.Itoa(i), func() (interface{}, error) {
+				return round, nil
+			})
+		}
+		assert.Equal(t, 4, fnl.Dump().Operations)
+
+		// Each flush deletes the cached results, the operation in process persists.
+		assert.Eventually(t, func() bool { return fnl.Dump().Operations == 1 }, time.Second, time.Millisecond)
+		assert.True(t, fnl.IsOpInProgress("in process"))
+		res, _ := fnl.Execute("0", func() (interface{}, error) {
+			return "executed again", nil
+		})
+		assert.Equal(t, "executed again", res)
+		fnl.Forget("0")
+	}
+
+	close(release)
+	res, err := inProcess.Await(context.Background())
+	assert.Equal(t, "res", res)
+	assert.Nil(t, err)
+}
+
+func TestGlobalFlushStoppedByClose(t *testing.T) {
+	numOfGoroutines := runtime.NumGoroutine()
+	fnl := New(WithCacheTtl(time.Hour), WithGlobalFlushInterval(time.Millisecond*10))
+	fnl.Execute("opId", func() (interface{}, error) {
+		return nil, nil
+	})
+
+	assert.Nil(t, fnl.Close())
+	assert.Nil(t, fnl.Close())
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > numOfGoroutines; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("The flush should stop once the funnel is closed")
+		}
+	}
+
+	// The cached results of the closed funnel are not flushed anymore.
+	time.Sleep(time.Millisecond * 30)
+	assert.True(t, fnl.IsOpInProgress("opId"))
+}
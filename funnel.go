@@ -6,16 +6,44 @@ package funnel
 // In addition, the results of the operation can be cached to prevent any identical operations being performed for a set period of time.
 
 import (
+	"container/list"
+	"context"
 	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/intuit/funnel/internal/schedule"
 	"github.com/mohae/deepcopy"
 	"github.com/tevino/abool"
+	"golang.org/x/time/rate"
 )
 
-//const error
-var timeoutError = errors.New("Timeout expired while waiting for operation execution to complete")
+// ErrTimeout is returned when the timeout expired before the operation completed (see WithTimeout), test it with
+// errors.Is.
+var ErrTimeout = errors.New("Timeout expired while waiting for operation execution to complete")
+
+// timeoutError is the error of the requests that timed out, compared by identity within the funnel.
+var timeoutError = ErrTimeout
+
+// abandonedError is the error of an operation that was deleted from the funnel before it could be executed.
+var abandonedError = errors.New("Operation was abandoned before it could be executed")
+
+// ErrServedStale is returned along with the last good result of an operation whose execution panicked, when the funnel
+// is configured to serve stale results on panic (see WithServeStaleOnPanic).
+var ErrServedStale = errors.New("Operation execution panicked, a previously cached result is served instead")
+
+// ErrRejected is returned when a request would start a new execution of an operation that the admission controller
+// rejects (see WithAdmissionController).
+var ErrRejected = errors.New("Execution of the operation was rejected by the admission controller")
+
+// ErrColdCache is returned by Execute when the funnel is configured to not wait on a cold cache (see WithColdMissAsync)
+// and the operation's result is not available yet. The operation executes in the background and its result will be
+// served to the following requests.
+var ErrColdCache = errors.New("Operation result is not cached yet, operation execution was started in the background")
 
 // opResult holds the result from executing of operation
 type opResult struct {
@@ -30,7 +58,7 @@ type opResult struct {
 	panicErr interface{}
 }
 
-type empty struct{}
+type empty = struct{}
 
 // operationInProcess holds the data on an operation in progress.
 type operationInProcess struct {
@@ -46,11 +74,147 @@ type operationInProcess struct {
 	// true when this operation has been deleted from the funnel
 	deleted *abool.AtomicBool
 
+	// The time until which the cached result is fresh, zero when it's not served stale afterwards (see
+	// WithStaleWhileRevalidate), and the stale result served while this execution refreshes it, if any.
+	freshUntil time.Time
+	stale      *operationInProcess
+
+	// replaceable is true when the function of the operation may be replaced until its execution starts, by the function
+	// of a request joining it (see ExecuteWithReplaceableFunc); replacedFunc is the last of these functions, and
+	// funcFixed is set once the execution started with the function.
+	replaceable  bool
+	replacedFunc func() (interface{}, error)
+	funcFixed    bool
+
+	// The stack of the execution's panic, captured only for the panic formatter (see WithPanicFormatter).
+	panicStack []byte
+
+	// true when the operation was deleted by Forget (or one of its variants) or replaced by SetOrWait, set before
+	// deleted. Unlike a timed out operation, a forgotten operation in process is still executed for the goroutines
+	// waiting for it.
+	forgotten bool
+
 	// Time at which this operation started executing
 	startTime time.Time
 
 	// Operation will be marked completed once a result is returned
 	completed *abool.AtomicBool
+
+	// true when the result returned by the operation should be cached, decided once the operation was completed.
+	cacheable bool
+
+	// true when the result was read through the external cache rather than executed, see WithReadThrough and WithCache.
+	readThrough bool
+
+	// The identifiers of the operations this operation depends on.
+	deps []string
+
+	// The index of the operation in the expiry queue of the funnel, meaningful only while its result is queued for
+	// deletion once expired (see scheduleExpiry).
+	expiryIndex int
+
+	// The time at which the cached result expires, zero until it's cached. A result is never served past this time,
+	// even if its expiry didn't delete the operation yet.
+	expiresAt time.Time
+
+	// true when each request served the cached result extends its lifetime, see WithSlidingCacheTtl.
+	sliding bool
+
+	// The number of requests for the operation, counted while the lock is held.
+	served int
+
+	// evictElem is the operation's element in the evictor's recency list, nil unless its result is cached with a maximum
+	// number of entries configured.
+	evictElem *list.Element
+
+	// copied is the copy of the result shared by the copy-callers, made once (see WithCopyCache).
+	copyOnce sync.Once
+	copied   interface{}
+
+	// cancelErr is the error of the requests once the operation was canceled, set before done is closed by Cancel.
+	cancelErr *CanceledError
+
+	// The estimated size of the result, computed only when it should be cached and a size function is configured.
+	size int
+
+	// The span of the execution, nil without a tracer (see WithTracer). Used only by the execution goroutine.
+	span ExecutionSpan
+
+	// The cache time-to-live decided for the result by the time-to-live function, if any (see WithTtlFunc).
+	ttl time.Duration
+
+	// The generation of the cached result, 0 until the result is cached. Guarded by the lock.
+	generation uint64
+
+	// The context the operation executes with and its cancellation, nil unless started by ExecuteContext.
+	execCtx    context.Context
+	cancelExec context.CancelCauseFunc
+
+	// The group the operation belongs to while in process, nil unless started by ExecuteContextGroup.
+	group *opGroup
+
+	// The configuration of the funnel as of the operation's creation, which the operation keeps (see SwapConfig).
+	config *Config
+
+	// The number of requests waiting for the operation, counted only when abandoned operations are canceled or with a
+	// shrinking deadline (see WithCancelAbandoned and WithShrinkingDeadline). Guarded by the lock.
+	waiting int
+
+	// The executions started concurrently for the operation's identifier, nil unless another one was started (see
+	// WithPerKeyConcurrency). Only the execution providing the cached result is held by the funnel.
+	concurrent *concurrentExecutions
+}
+
+// callConfig holds the parameters of a single request to the funnel, applied when the request starts a new execution.
+type callConfig struct {
+	// The cost of the execution with respect to the concurrency budget.
+	cost int
+
+	// The identifiers of the operations that the execution depends on.
+	deps []string
+
+	// when true, the execution runs on the goroutine of the request, see WithSynchronous.
+	synchronous bool
+
+	// The context of the request, which bounds its wait, nil for requests without a context.
+	ctx context.Context
+
+	// The context of the execution and its cancellation, nil for requests without a context (see ExecuteContext).
+	execCtx    context.Context
+	cancelExec context.CancelCauseFunc
+
+	// The context the request's function receives, replaced by the goroutine executing the operation with the context
+	// returned by the tracer (see Tracer), nil for requests without a context.
+	spanCtx *context.Context
+
+	// The group the operation is tagged with when the request starts it, nil for requests without a group.
+	group *groupKey
+
+	// when true, the request receives a copy of the result, see ExecuteAndCopyResult.
+	copyResult bool
+
+	// when true, the request's function may replace the function of the operation it joins, see ExecuteWithReplaceableFunc.
+	replaceableFunc bool
+
+	// The timeout of the request overriding the funnel's timeout, 0 when not overridden (see WithCallTimeout), and the
+	// deadline overriding both, zero when not overridden (see WithCallDeadline).
+	timeout  time.Duration
+	deadline time.Time
+
+	// when true, the request leaves the operation it timed out on in process, see ExecuteWithFallback.
+	keepTimedOut bool
+
+	// when true, the request waits for the operation it starts or joins, and is counted in its waiters by
+	// startOperation (see awaitCounted).
+	awaits bool
+}
+
+// waitContext returns the context bounding the wait of the request.
+func (call callConfig) waitContext() context.Context {
+	if call.ctx == nil {
+		return context.Background()
+	}
+	return call.ctx
 }
 
 // A Config structure is used to configure the Funnel
@@ -64,6 +228,162 @@ type Config struct {
 
 	// function determines if a result should be cached or not
 	shouldCache func(interface{}, error) bool
+
+	// the total cost of operations that may execute concurrently. A budget of 0 means unlimited.
+	concurrencyBudget int
+
+	// when true, requests that find no completed result return ErrColdCache immediately instead of waiting.
+	coldMissAsync bool
+
+	// scheduler is consulted at key points of each operation's lifecycle, installed by package funneltest only.
+	scheduler schedule.Scheduler
+
+	// encode and decode serialize results for storage outside of the process memory.
+	encode func(interface{}) ([]byte, error)
+	decode func([]byte) (interface{}, error)
+
+	// when true, results are test-encoded before being cached and results that can't be encoded are not cached.
+	validateSerializable bool
+
+	// onInternalError is notified of errors the funnel encounters that can't be returned to any caller.
+	onInternalError func(operationId string, err error)
+
+	// name identifies the funnel in the events it reports, generated when not configured.
+	name string
+
+	// the sustained rate and the burst size at which each operation may be executed. A rate of 0 means unlimited.
+	perKeyRate  rate.Limit
+	perKeyBurst int
+
+	// onPanic is notified of every panic recovered from an operation.
+	onPanic func(operationId string, recovered interface{})
+
+	// when true, an operation that panics serves the last good result of the same operation, if any, to its waiters.
+	serveStaleOnPanic bool
+
+	// the time-to-live of a cached result, extended by each request served the result, see WithSlidingCacheTtl.
+	slidingCacheTtl time.Duration
+
+	// ttlFunc decides the cache time-to-live of each result, overriding the static ones, see WithTtlFunc.
+	ttlFunc func(res interface{}, err error) time.Duration
+
+	// logger is notified of the lifecycle of the operations, see WithLogger.
+	logger Logger
+
+	// tracer traces the executions of the operations and the requests for them, see WithTracer.
+	tracer Tracer
+
+	// the time after the expiry of a result within which re-creating its operation counts as a near-miss.
+	nearMissGrace time.Duration
+
+	// the fraction of the cache time-to-live by which the time-to-live of each result is randomized, see WithCacheTtlJitter.
+	cacheTtlJitter float64
+
+	// the time beyond the cache time-to-live for which a successful result is served stale while being refreshed.
+	staleWhileRevalidate time.Duration
+
+	// metrics is notified of the outcome of the requests and of the executions, see WithMetrics.
+	metrics Metrics
+
+	// panicFormatter makes the errors describing the panics of the operations, see WithPanicFormatter.
+	panicFormatter func(recovered interface{}, stack []byte) error
+
+	// panicAsError converts the panic of an operation into the error its waiters receive, nil to have them panic.
+	panicAsError func(recovered interface{}) error
+
+	// identity derives an operation's identifier from its arguments, see ExecuteIdentity.
+	identity func(args interface{}) (key string, ok bool)
+
+	// the time after which an execution that didn't return yet is hedged by another one, and the maximum number of
+	// additional executions per operation. A maximum of 0 disables hedging.
+	hedgeDelay time.Duration
+	maxHedges  int
+
+	// auditSink receives a record of every execution.
+	auditSink AuditSink
+
+	// extractKey derives the stable identity of an operation from the identifier passed by the caller.
+	extractKey func(rawKey string) string
+
+	// the number of times a request that timed out waiting starts waiting again on a fresh operation.
+	waiterRetries int
+
+	// the maximum number of cached results, and the policy selecting which to evict. A maximum of 0 means unlimited.
+	maxEntries     int
+	evictionPolicy EvictionPolicy
+
+	// onWastedWait is notified of requests that joined an operation in process and timed out waiting for it.
+	onWastedWait func(operationId string, waited time.Duration)
+
+	// loader loads the values requested by GetOrLoad.
+	loader Loader
+
+	// batchLoader loads the values requested by GetOrLoadAll.
+	batchLoader BatchLoader
+
+	// when true, ExecuteAndCopyResult copies each result once and shares the copy among its callers.
+	copyCache bool
+
+	// the maximum time for copying a result for ExecuteAndCopyResult, unbounded when 0, see WithCopyTimeout.
+	copyTimeout time.Duration
+
+	// retryBackoff retries failed executions, nil when retries are not configured.
+	retryBackoff *retryBackoff
+
+	// sizeFunc estimates the size of the cached results, see WithSizeFunc.
+	sizeFunc func(res interface{}) int
+
+	// when true, requests execute the operations they start on their own goroutine.
+	synchronous bool
+
+	// cacheableError decides which errors returned by operations are cached, all of them when nil.
+	cacheableError func(err error) bool
+
+	// the time for which results with an error remain cached, when configured. A time to live of 0 prohibits caching errors.
+	negativeCacheTtl    time.Duration
+	hasNegativeCacheTtl bool
+
+	// onExecuted is notified of every execution that returned, with the execution's context.
+	onExecuted func(ctx context.Context, operationId string, served int)
+
+	// admit decides whether a new execution may start, see WithAdmissionController.
+	admit func(operationId string) bool
+
+	// onFirstSeen is notified of the first creation of an operation with each identifier.
+	onFirstSeen func(operationId string)
+
+	// the maximum number of concurrent executions per operation identifier, and the policy selecting which one's result is
+	// cached. A maximum of 0 or 1 means a single execution.
+	perKeyConcurrency      int
+	concurrentResultPolicy ConcurrentResultPolicy
+
+	// when true, an operation in process is deleted once all of its waiters left, see WithShrinkingDeadline.
+	shrinkingDeadline bool
+
+	// when true, the execution of an operation in process is canceled once all of its waiters gave up.
+	cancelAbandoned bool
+
+	// the time for which the occupancy of the funnel's map must remain low before the map is compacted. A time of 0
+	// disables compaction.
+	compactAfter time.Duration
+
+	// writeBehind is notified asynchronously of the cached results, see WithWriteBehind.
+	writeBehind func(operationId string, res interface{}, err error, ttl time.Duration)
+
+	// externalCache is consulted before executing the operations, and the results are written through to it, see WithCache.
+	externalCache Cache
+
+	// readThrough looks the results up in an external cache before executing the operations, see WithReadThrough.
+	readThrough func(operationId string) (res interface{}, err error, ok bool)
+
+	// the interval at which all the cached results are deleted. An interval of 0 disables the global flush.
+	globalFlushInterval time.Duration
+
+	// the name under which the funnel's counters are published with expvar, none when empty.
+	expvarName string
+
+	// backend broadcasts the invalidations of the operations between the funnels sharing it, see WithBackend.
+	backend Backend
 }
 
 // The purpose of Funnel is to prevent running of identical operations in concurrently.
@@ -76,62 +396,282 @@ type Funnel struct {
 	opInProcess map[string]*operationInProcess
 	sync.Mutex
 
-	// Configuration for Funnel
-	config Config
+	// Configuration for Funnel, replaced as a whole by SwapConfig.
+	config atomic.Pointer[Config]
+
+	// gate limits the total cost of concurrently executing operations, nil when no budget is configured.
+	gate *costGate
+
+	// dependents maps an operation's identifier to the identifiers of the operations in process that depend on it.
+	dependents map[string]map[string]empty
+
+	// rateLimiter limits the rate of executions per operation, nil when no rate is configured.
+	rateLimiter *keyRateLimiter
+
+	// lastGood holds the last successful result of each operation, kept only when serving stale results on panic.
+	lastGood map[string]opResult
+
+	// counters are updated atomically and reported by Stats.
+	counters counters
+
+	// evictor bounds the number of cached results, nil when no maximum is configured.
+	evictor *evictor
+
+	// resultBytes is the total estimated size of the cached results, computed only when a size function is configured.
+	resultBytes int
+
+	// lastGeneration is the generation of the last cached result.
+	lastGeneration uint64
+
+	// seen holds the identifiers of the operations created so far, nil unless notifying first seen identifiers.
+	seen *seenSet
+
+	// expired holds the identifiers of the operations expired within the near-miss grace, nil unless tracking them.
+	expired *expiredSet
+
+	// backend is the backend the funnel subscribed to at creation, and invalidations its subscription, see WithBackend.
+	backend       Backend
+	invalidations <-chan string
+
+	// groups holds the groups of operations in process, see ExecuteContextGroup.
+	groups map[groupKey]*opGroup
+
+	// peakOps is the largest number of operations held since opInProcess was created, which its footprint is sized
+	// for, and compaction the pending rebuild of opInProcess into a smaller map, nil when none is pending.
+	peakOps    int
+	compaction *time.Timer
+
+	// writeBehind writes the cached results behind, nil until a result is written behind.
+	writeBehind *writeBehind
+
+	// closed is closed by Close, under the lock, stopping the background work.
+	closed    chan empty
+	closeOnce sync.Once
+
+	// running counts the executions that didn't return yet, see Shutdown.
+	running sync.WaitGroup
+
+	// expiries queues the cached operations by the expiry of their results, and expiryTimer fires at the earliest one.
+	expiries    expiryHeap
+	expiryTimer *time.Timer
 }
 
-// Return a pointer to a new Funnel. By default the timeout is one minute and
+// numOfFunnels counts the funnels created so far, used for generating their default names.
+var numOfFunnels uint64
+
+// Return a pointer to a new Funnel. New panics if the options are inconsistent. By default the timeout is one minute and
 // the cacheTtl is 0. You can pass options to change it, for example:
 //
 //	// Create Funnel with cacheTtl of 5 seconds and timeout of 3 minutes.
 // 	funnel.New(funnel.WithCacheTtl(time.Second*5),funnel.WithTimeout(time.Minute*3))
 //
 func New(option ...Option) *Funnel {
-	cfg := Config{
-		timeout:  time.Duration(time.Minute),
-		cacheTtl: 0,
-		shouldCache: func(s interface{}, err error) bool {
-			return true
-		},
+	cfg := NewConfig(option...)
+	if cfg.name == "" {
+		cfg.name = fmt.Sprintf("funnel-%d", atomic.AddUint64(&numOfFunnels, 1))
 	}
 
-	for _, opt := range option {
-		opt(&cfg)
+	f := &Funnel{
+		opInProcess: make(map[string]*operationInProcess),
+		dependents:  make(map[string]map[string]empty),
+		lastGood:    make(map[string]opResult),
+		groups:      make(map[groupKey]*opGroup),
+		closed:      make(chan empty),
+	}
+	f.config.Store(&cfg)
+	if cfg.concurrencyBudget > 0 {
+		f.gate = newCostGate(cfg.concurrencyBudget)
+	}
+	if cfg.perKeyRate > 0 {
+		f.rateLimiter = newKeyRateLimiter(cfg.perKeyRate, cfg.perKeyBurst)
+	}
+	if cfg.maxEntries > 0 {
+		f.evictor = newEvictor(cfg.evictionPolicy, cfg.maxEntries)
+	}
+	if cfg.globalFlushInterval > 0 {
+		go f.flushPeriodically(cfg.globalFlushInterval)
+	}
+	if cfg.expvarName != "" {
+		f.publishExpvar(cfg.expvarName)
 	}
+	if cfg.backend != nil {
+		f.backend, f.invalidations = cfg.backend, cfg.backend.Subscribe()
+		go f.receiveInvalidations(f.invalidations)
+	}
+	return f
+}
 
-	return &Funnel{
-		opInProcess: make(map[string]*operationInProcess),
-		config:      cfg,
+// await waits for the operation on behalf of a request, which is counted in the funnel's waiters while it waits.
+// The timeout is measured from the start of the operation. counted reports whether startOperation already counted the
+// request in the operation's waiters (see callConfig.awaits).
+func (f *Funnel) await(ctx context.Context, op *operationInProcess, timeout time.Duration, counted bool) (res interface{}, opErr error, deliveryErr error) {
+	atomic.AddInt64(&f.counters.waiters, 1)
+	defer atomic.AddInt64(&f.counters.waiters, -1)
+	defer func() {
+		if deliveryErr == timeoutError {
+			atomic.AddUint64(&f.counters.timeouts, 1)
+			if op.config.metrics != nil {
+				op.config.metrics.OnTimeout(op.operationId)
+			}
+			if op.config.logger != nil {
+				op.config.logger.Debugf("funnel %s: request timed out waiting for operation %s", op.config.name, op.operationId)
+			}
+		}
+	}()
+	if op.countsWaiters() {
+		return f.awaitCounted(ctx, op, timeout, counted)
 	}
+	return op.waitDetailed(ctx, timeout)
 }
 
 // Waiting for completion of the operation and then returns the operation's result or error in case of timeout.
-func (op *operationInProcess) wait(timeout time.Duration) (res interface{}, err error) {
+// Returns the operation's error apart from the error that prevented the delivery of the result (the timeout, or a
+// *CanceledError when the operation was canceled or the context is done).
+// All the waiters share the operation's done channel, the only memory a waiter holds is its timer (see waiterMemory).
+func (op *operationInProcess) waitDetailed(ctx context.Context, timeout time.Duration) (res interface{}, opErr error, deliveryErr error) {
 	operationElapsedTime := time.Since(op.startTime)
 	operationTimeoutRemaining := timeout - operationElapsedTime
 
+	// A completed operation is delivered right away, without a timer.
 	select {
 	case <-op.done:
-		if op.panicErr != nil { // If the operation ended with panic, this pending request also ends the same way.
-			panic(op.panicErr)
-		}
-		return op.res, op.err
-	case <-time.After(operationTimeoutRemaining):
+		return op.delivered()
+	default:
+	}
+
+	// Stopped once done waiting, so that the timer doesn't outlive the wait.
+	timer := time.NewTimer(operationTimeoutRemaining)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, &CanceledError{OperationId: op.operationId, Reason: context.Cause(ctx)}
+	case <-op.done:
+		return op.delivered()
+	case <-timer.C:
 		if op.completed.IsSet() {
-			return op.res, op.err
+			return op.res, op.err, nil
 		}
-		return nil, timeoutError
+		return nil, nil, timeoutError
+	}
+}
+
+// delivered returns the outcome of the operation to a request, once done is closed.
+func (op *operationInProcess) delivered() (res interface{}, opErr error, deliveryErr error) {
+	if op.cancelErr != nil {
+		return nil, nil, op.cancelErr
+	}
+	if op.panicErr != nil { // If the operation ended with panic, this pending request also ends the same way.
+		panic(op.panicErr)
+	}
+	return op.res, op.err, nil
+}
+
+// inProcess reports whether the operation is still in process: neither completed nor ended with panic, which closes its
+// done channel without completing it.
+func (op *operationInProcess) inProcess() bool {
+	if op.completed.IsSet() {
+		return false
+	}
+	select {
+	case <-op.done:
+		return false
+	default:
+		return true
 	}
 }
 
 // getOperationInProcess returns structure that holds the data about an identical operation currently in progress,
-// in case an identical operation does not exist, it starts a new one.
-func (f *Funnel) getOperationInProcess(operationId string, opExeFunc func() (interface{}, error)) (op *operationInProcess) {
+// in case an identical operation does not exist, it starts a new one according to the call's configuration.
+// Returns ErrRateLimited when a new execution is not allowed by the operation's rate limit.
+func (f *Funnel) getOperationInProcess(operationId string, call callConfig, opExeFunc func() (interface{}, error)) (op *operationInProcess, err error) {
+	op, _, err = f.startOperation(operationId, call, opExeFunc)
+	return op, err
+}
+
+// startOperation is like getOperationInProcess, but also reports whether it started a new operation.
+func (f *Funnel) startOperation(operationId string, call callConfig, opExeFunc func() (interface{}, error)) (op *operationInProcess, started bool, err error) {
+	// The keys are extracted before taking the lock, since the key extractor is user code.
+	operationId = f.key(operationId)
+	deps := f.keys(call.deps) // Copied, since the caller may reuse the slice.
+
+	// The handler and the metrics are notified once the lock is released.
+	var cfg *Config
+	firstSeen := false
+	defer func() {
+		if firstSeen {
+			cfg.onFirstSeen(operationId)
+		}
+		if err == nil {
+			f.requested(call.ctx, cfg, operationId, op, started)
+		}
+	}()
+
 	f.Lock()
 	defer f.Unlock()
 
-	if op, found := f.opInProcess[operationId]; found {
-		return op
+	if call.awaits {
+		// Counted before the lock is released, so that the other waiters can't abandon the operation meanwhile.
+		defer func() {
+			if err == nil && op.countsWaiters() {
+				op.waiting++
+			}
+		}()
+	}
+
+	if f.isClosed() {
+		return nil, false, ErrFunnelClosed
+	}
+	cfg = f.currentConfig()
+
+	op, found := f.findOperation(operationId)
+	if f.evictor != nil {
+		f.evictor.requested(operationId, op)
+	}
+
+	// A stale result is served while an execution refreshes it, see WithStaleWhileRevalidate.
+	var stale *operationInProcess
+	if found && op.isStale() {
+		stale, found = op, false
+	} else if found {
+		op = op.serving()
+	}
+	if found && !op.completed.IsSet() {
+		joined, start := f.joinConcurrent(op)
+		if start {
+			return f.startConcurrent(op, call, opExeFunc), true, nil
+		}
+		op = joined
+	}
+	if found {
+		op.served++
+		f.touch(op)
+		if call.replaceableFunc {
+			op.replaceFunc(opExeFunc)
+		}
+		return op, false, nil
+	}
+
+	if cfg.admit != nil {
+		// The controller is consulted without holding the lock, meanwhile another request may start the operation,
+		// in which case this request joins it whether admitted or not.
+		f.Unlock()
+		admitted := cfg.admit(operationId)
+		f.Lock()
+
+		if op, found = f.recheck(operationId, stale); found {
+			return op, false, nil
+		}
+		if !admitted {
+			return f.serveStale(stale, ErrRejected)
+		}
+	}
+
+	if f.rateLimiter != nil && !f.rateLimiter.allow(operationId) {
+		return f.serveStale(stale, ErrRateLimited)
+	}
+	if stale != nil {
+		f.removeOperation(stale)
 	}
 
 	// In case there is no such an operation in process, it creates a new one and executes it.
@@ -141,60 +681,491 @@ func (f *Funnel) getOperationInProcess(operationId string, opExeFunc func() (int
 		startTime:   time.Now(),
 		deleted:     abool.New(),
 		completed:   abool.New(),
+		served:      1,
+		deps:        deps,
+		execCtx:     call.execCtx,
+		cancelExec:  call.cancelExec,
+		config:      cfg,
+		stale:       stale,
+		replaceable: call.replaceableFunc,
 	}
+	f.running.Add(1)
 	f.opInProcess[operationId] = op
+	f.grown()
+	f.created(operationId)
+	f.registerDeps(op)
+	if call.group != nil {
+		f.joinGroup(op, *call.group)
+	}
+	if cfg.onFirstSeen != nil {
+		if f.seen == nil {
+			f.seen = newSeenSet() // Once a configuration with a handler is swapped in, see SwapConfig.
+		}
+		firstSeen = f.seen.see(operationId)
+	}
+
+	// Executing the operation, unless the caller executes it synchronously once the lock is released. A refresh is
+	// never executed synchronously, since the caller is served with the stale result right away.
+	if stale != nil {
+		op.served = 0
+		go f.run(op, call, opExeFunc)
+		stale.served++
+		return stale, false, nil
+	}
+	if !call.synchronous {
+		go f.run(op, call, opExeFunc)
+	}
 
-	// Executing the operation
-	go func(opInProc *operationInProcess) {
-		// closeOperation must be performed within defer function to ensure the closure of the channel.
-		defer f.closeOperation(opInProc)
-		opInProc.res, opInProc.err = opExeFunc()
-		opInProc.completed.Set()
-	}(op)
+	return op, true, nil
+}
 
-	return op
+// recheck returns the operation to serve to the request if another request created the operation while the lock was
+// released, so that a single operation is created per identifier; the stale operation the request is about to refresh
+// doesn't count (see WithStaleWhileRevalidate). It must be called after any release of the lock between finding no
+// operation and creating it. Must be called with the lock held.
+func (f *Funnel) recheck(operationId string, stale *operationInProcess) (*operationInProcess, bool) {
+	op, found := f.findOperation(operationId)
+	if !found || op == stale {
+		return nil, false
+	}
+	op = op.serving()
+	op.served++
+	f.touch(op)
+	return op, true
+}
+
+// startConcurrent starts another execution of the operation in process, which the funnel doesn't hold until it provides
+// the cached result (see WithConcurrentResultPolicy). Must be called with the lock held.
+func (f *Funnel) startConcurrent(op *operationInProcess, call callConfig, opExeFunc func() (interface{}, error)) *operationInProcess {
+	concurrentOp := &operationInProcess{
+		operationId: op.operationId,
+		done:        make(chan empty),
+		startTime:   time.Now(),
+		deleted:     abool.New(),
+		completed:   abool.New(),
+		served:      1,
+		execCtx:     call.execCtx,
+		cancelExec:  call.cancelExec,
+		concurrent:  op.concurrent,
+		config:      op.config,
+	}
+	op.concurrent.ops = append(op.concurrent.ops, concurrentOp)
+	f.running.Add(1)
+	if call.group != nil {
+		f.joinGroup(concurrentOp, *call.group)
+	}
+
+	if !call.synchronous {
+		go f.run(concurrentOp, call, opExeFunc)
+	}
+	return concurrentOp
+}
+
+// run executes the operation and closes it with the outcome.
+func (f *Funnel) run(opInProc *operationInProcess, call callConfig, opExeFunc func() (interface{}, error)) {
+	// closeOperation must be performed within defer function to ensure the closure of the channel.
+	defer f.running.Done()
+	defer f.closeOperation(opInProc)
+	opInProc.startSpan(call)
+
+	// A result found in the external cache spares the execution, and the concurrency budget.
+	if readThrough := opInProc.config.readThrough; readThrough != nil {
+		if res, err, ok := readThrough(opInProc.operationId); ok {
+			opInProc.res, opInProc.err = res, err
+			opInProc.readThrough = true
+			f.complete(opInProc)
+			return
+		}
+	}
+	if res, ok := f.getCached(opInProc); ok {
+		opInProc.res, opInProc.readThrough = res, true
+		f.complete(opInProc)
+		return
+	}
+
+	if f.gate != nil {
+		// The cost is returned to the budget within defer function to ensure it is released on panic as well.
+		defer f.gate.release(f.gate.acquire(call.cost))
+
+		// An operation abandoned while waiting for the budget (e.g. all of its callers timed out) is not executed,
+		// so that the budget isn't spent on a result nobody will receive. A forgotten operation still has waiters.
+		if opInProc.deleted.IsSet() && !opInProc.forgotten {
+			opInProc.err = abandonedError
+			return
+		}
+	}
+	if opInProc.replaceable {
+		opExeFunc = f.fixFunc(opInProc, opExeFunc)
+	}
+	f.reach(schedule.BeforeExecute, opInProc.operationId)
+	execute := opExeFunc
+	if opInProc.config.maxHedges > 0 {
+		execute = func() (interface{}, error) {
+			return f.runHedged(opInProc, opExeFunc)
+		}
+	}
+	if opInProc.config.retryBackoff != nil {
+		opInProc.res, opInProc.err = opInProc.config.retryBackoff.run(opInProc, execute)
+	} else {
+		opInProc.res, opInProc.err = execute()
+	}
+	f.executed(opInProc)
+	f.complete(opInProc)
+}
+
+// complete decides whether the result of the operation should be cached, and marks the operation completed.
+func (f *Funnel) complete(op *operationInProcess) {
+	op.cacheable = op.config.isCacheableError(op.err) && op.config.shouldCache(op.res, op.err) && f.validateSerializable(op)
+	if op.cacheable && op.config.ttlFunc != nil {
+		op.ttl = op.config.ttlFunc(op.res, op.err)
+		op.cacheable = op.ttl > 0
+	}
+	if op.cacheable && op.config.sizeFunc != nil {
+		op.size = op.config.sizeFunc(op.res)
+	}
+	op.completed.Set()
+}
+
+// isCancellation reports whether the error is a context's cancellation or deadline error, which is incidental to the
+// execution that returned it rather than an outcome of the operation, and should therefore never be cached.
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isCacheableError reports whether a result with the error may be cached. A nil error is always cacheable, and a
+// cancellation error never is.
+func (cfg *Config) isCacheableError(err error) bool {
+	if err == nil {
+		return true
+	}
+	if isCancellation(err) || (cfg.hasNegativeCacheTtl && cfg.negativeCacheTtl <= 0) {
+		return false
+	}
+	return cfg.cacheableError == nil || cfg.cacheableError(err)
+}
+
+// validateSerializable reports whether the result of the completed operation can be encoded, and decoded back, with the
+// configured codec. A failure, including a panic of the codec, is reported to the internal error handler.
+// Without validation every result is considered serializable.
+func (f *Funnel) validateSerializable(op *operationInProcess) (ok bool) {
+	if !op.config.validateSerializable || op.err != nil {
+		return true
+	}
+
+	defer func() {
+		if rr := recover(); rr != nil {
+			f.internalError(op.operationId, fmt.Errorf("codec panicked on result of operation %s: %v", op.operationId, rr))
+			ok = false
+		}
+	}()
+
+	b, err := op.config.encode(op.res)
+	if err == nil && op.config.decode != nil {
+		_, err = op.config.decode(b)
+	}
+	if err != nil {
+		f.internalError(op.operationId, fmt.Errorf("result of operation %s is not serializable: %w", op.operationId, err))
+		return false
+	}
+	return true
+}
+
+// InternalError is the type of the errors reported to the internal error handler (see WithOnInternalError).
+// It carries the name of the funnel that reported the error, so that errors from several funnels can be told apart.
+type InternalError struct {
+	// The name of the funnel, see WithName.
+	Funnel string
+
+	// The identifier of the operation being handled.
+	OperationId string
+
+	// The error the funnel encountered.
+	Err error
+}
+
+// Error returns the funnel's name followed by the error's message.
+func (e *InternalError) Error() string {
+	return e.Funnel + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error the funnel encountered.
+func (e *InternalError) Unwrap() error {
+	return e.Err
+}
+
+// internalError reports an error to the configured internal error handler, if any, as an *InternalError.
+func (f *Funnel) internalError(operationId string, err error) {
+	if cfg := f.currentConfig(); cfg.onInternalError != nil {
+		cfg.onInternalError(operationId, &InternalError{Funnel: cfg.name, OperationId: operationId, Err: err})
+	}
+}
+
+// Name returns the name of the funnel, as configured by WithName or generated by New.
+func (f *Funnel) Name() string {
+	return f.currentConfig().name
 }
 
 // Closes the operation by updates the operation's result and closure of done channel.
 func (f *Funnel) closeOperation(op *operationInProcess) {
+	f.reach(schedule.BeforeClose, op.operationId)
+
+	// Handlers are notified once the lock is released, so that they can't stall the funnel.
+	var notifications []func()
+	defer func() {
+		for _, notify := range notifications {
+			notify()
+		}
+	}()
+
+	// The panic is converted into an error, if so configured, before taking the lock since the handler is user code.
+	rr := recover()
+	var panicAsErr error
+	if rr != nil && op.config.panicAsError != nil {
+		panicAsErr = op.config.panicAsError(rr)
+	}
+
+	if end := op.endSpan(rr); end != nil {
+		notifications = append(notifications, end)
+	}
+
 	f.Lock()
 	defer f.Unlock()
 
-	//Check if the operation completed after a timeout which would result in the operation being deleted from the funnel.
+	if logger := op.config.logger; logger != nil {
+		defer func() { // Run with the lock held, the completion is logged once it's released.
+			name, cached := op.config.name, f.opInProcess[op.operationId] == op && !op.expiresAt.IsZero()
+			notifications = append(notifications, func() {
+				if rr != nil {
+					logger.Debugf("funnel %s: operation %s panicked: %v", name, op.operationId, rr)
+				} else {
+					logger.Debugf("funnel %s: operation %s completed, error: %v, cached: %t", name, op.operationId, op.err, cached)
+				}
+			})
+		}()
+	}
+	f.leaveGroup(op)
+
+	// An execution abandoned before it started is not audited, since the operation was not executed.
+	if op.config.auditSink != nil && !(op.err == abandonedError && rr == nil) {
+		rec := f.auditRecord(op, rr)
+		notifications = append(notifications, func() { op.config.auditSink.Record(rec) })
+	}
+
+	if rr != nil {
+		op.panicErr = rr
+		atomic.AddUint64(&f.counters.panics, 1)
+		if op.config.panicFormatter != nil {
+			op.panicStack = debug.Stack() // Still the stack of the panic, since closeOperation is deferred by the execution.
+		}
+		if op.config.onPanic != nil {
+			notifications = append(notifications, func() { op.config.onPanic(op.operationId, rr) })
+		}
+		if op.config.metrics != nil {
+			notifications = append(notifications, func() { op.config.metrics.OnPanic(op.operationId) })
+		}
+
+		// The waiting goroutines receive the last good result instead of the panic, which isn't cached so that the
+		// next request re-executes the operation.
+		if stale, found := f.lastGood[op.operationId]; found && op.config.serveStaleOnPanic {
+			op.panicErr = nil
+			op.res, op.err = stale.res, ErrServedStale
+			op.cacheable = false
+			op.completed.Set()
+		} else if op.config.panicAsError != nil {
+			// Likewise, the waiting goroutines receive the error the panic was converted into, which isn't cached.
+			op.panicErr = nil
+			op.res, op.err = nil, panicAsErr
+			op.cacheable = false
+			op.completed.Set()
+		}
+	}
+
+	// Check if the operation completed after it was deleted from the funnel (following a timeout or being forgotten).
+	// Its result is not cached, but goroutines which may still be waiting for it are released, unless Cancel did.
+	// Since the waiters may all be gone, a panic is reported as well, so that it isn't lost.
 	if op.deleted.IsSet() {
+		if op.panicErr != nil || panicAsErr != nil {
+			notifications = append(notifications, func() { f.internalError(op.operationId, op.orphanedPanicError(rr)) })
+		}
+		if op.cancelErr == nil {
+			close(op.done)
+		}
 		return
 	}
 
-	if rr := recover(); rr != nil {
-		op.panicErr = rr
+	if rr == nil {
+		atomic.AddUint64(&f.counters.cleanCompletions, 1)
 	}
 
-	// Deletion of operationInProcess from the map will occur only when the cache time-to-live will be expired.
-	go func() {
-		time.Sleep(f.config.cacheTtl)
-		f.deleteOperation(op)
-	}()
+	// Only one of the concurrent executions of an operation provides its cached result, the others are delivered to
+	// their waiters only.
+	if op.concurrent != nil && !f.settleConcurrent(op) {
+		op.deleted.SetTo(true)
+		close(op.done)
+		return
+	}
+
+	// When requests don't wait on a cold cache nobody receives the panic, so instead of keeping it cached (and the cache
+	// cold until the timeout) the operation is deleted right away and the panic is reported.
+	if op.panicErr != nil && op.config.coldMissAsync {
+		notifications = append(notifications, func() { f.internalError(op.operationId, op.panicError(rr)) })
+		f.removeOperation(op)
+		close(op.done)
+		return
+	}
+
+	// A result that should not be cached is deleted right away, the waiting goroutines still receive it. With negative
+	// caching a panic is never cached, rather than for the cache time-to-live of the successful results.
+	if (op.panicErr == nil && !op.cacheable) || (op.panicErr != nil && op.config.hasNegativeCacheTtl) {
+		f.removeOperation(op)
+		close(op.done)
+		return
+	}
+
+	if notify := f.cache(op); notify != nil {
+		notifications = append(notifications, notify)
+	}
 
 	// Releases all the goroutines which are waiting for the operation result.
 	close(op.done)
 }
 
+// cache caches the result of the completed operation, which the funnel holds, until its time-to-live elapses. Returns
+// the notification of the write-behind of the result, and of the eviction of a result, to make once the lock is
+// released, if any. Must be called with the lock held.
+func (f *Funnel) cache(op *operationInProcess) (notify func()) {
+	var notifications []func()
+	if op.config.serveStaleOnPanic && op.panicErr == nil && op.err == nil {
+		f.lastGood[op.operationId] = op.opResult
+	}
+
+	// Deletion of operationInProcess from the map will occur only when the cache time-to-live will be expired.
+	ttl := op.config.cacheTtl
+	if op.config.slidingCacheTtl > 0 {
+		ttl, op.sliding = op.config.slidingCacheTtl, true
+	}
+	if op.err != nil && op.config.hasNegativeCacheTtl {
+		ttl, op.sliding = op.config.negativeCacheTtl, false
+	}
+	if op.config.ttlFunc != nil {
+		ttl, op.sliding = op.ttl, false
+	}
+	if jitter := op.config.cacheTtlJitter; jitter > 0 {
+		ttl = time.Duration(float64(ttl) * (1 + jitter*(2*rand.Float64()-1)))
+	}
+	op.expiresAt = time.Now().Add(ttl)
+	op.stale = nil
+	if op.config.staleWhileRevalidate > 0 && op.err == nil {
+		op.freshUntil = op.expiresAt
+		op.expiresAt = op.expiresAt.Add(op.config.staleWhileRevalidate)
+	}
+	f.resultBytes += op.size
+	f.lastGeneration++
+	op.generation = f.lastGeneration
+	f.scheduleExpiry(op)
+	if op.config.writeBehind != nil && !op.readThrough {
+		if f.writeBehind == nil {
+			f.writeBehind = newWriteBehind()
+		}
+		entry := writeBehindEntry{write: op.config.writeBehind, operationId: op.operationId, opResult: op.opResult, ttl: ttl}
+		notifications = append(notifications, func() { f.enqueueWriteBehind(entry) })
+	}
+	if write := f.setCached(op, ttl); write != nil {
+		notifications = append(notifications, write)
+	}
+
+	// Beyond the maximum number of cached results, one is evicted, possibly this one; its waiters still receive it.
+	if f.evictor != nil {
+		if victim := f.evictor.cached(op); victim != nil {
+			f.removeOperation(victim)
+			if logger := op.config.logger; logger != nil {
+				name, victimId := op.config.name, victim.operationId
+				notifications = append(notifications, func() { logger.Debugf("funnel %s: operation %s evicted", name, victimId) })
+			}
+		}
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	return func() {
+		for _, notify := range notifications {
+			notify()
+		}
+	}
+}
+
+// panicError returns the error describing the value recovered from the panic of the operation, as made by the panic
+// formatter if any (see WithPanicFormatter).
+func (op *operationInProcess) panicError(recovered interface{}) error {
+	if op.config.panicFormatter != nil {
+		return op.config.panicFormatter(recovered, op.panicStack)
+	}
+	return fmt.Errorf("operation %s panicked: %v", op.operationId, recovered)
+}
+
+// orphanedPanicError is like panicError, for the panic of an execution that returned after its operation was deleted.
+func (op *operationInProcess) orphanedPanicError(recovered interface{}) error {
+	if op.config.panicFormatter != nil {
+		return fmt.Errorf("operation %s was deleted before its execution panicked: %w", op.operationId, op.panicError(recovered))
+	}
+	return fmt.Errorf("operation %s panicked after it was deleted: %v", op.operationId, recovered)
+}
+
 // Delete the operation from the map.
 // Once deleted, we do not hold the operation's result anymore, therefore any further request for the
-// same operation will require re-execution of it.
-func (f *Funnel) deleteOperation(operation *operationInProcess) {
+// same operation will require re-execution of it. Returns true if this call deleted the operation.
+func (f *Funnel) deleteOperation(operation *operationInProcess) bool {
 	if operation.deleted.IsSet() {
-		return
+		return false
 	}
 
+	f.reach(schedule.BeforeDelete, operation.operationId)
+
 	f.Lock()
 	defer f.Unlock()
 
 	//each timeout will call deleteOperation.  Only the first timeout should carry out deletion since a stalled app may delete a recreated operation with the same id.
 	if !operation.deleted.IsSet() {
+		f.removeOperation(operation)
+		return true
+	}
+	return false
+}
+
+// findOperation returns the operation in the funnel with the given identifier. An operation whose cached result expired
+// is removed instead of being returned, since its expiry may run late (e.g. with a time-to-live shorter than the
+// timer's precision). Must be called with the lock held.
+func (f *Funnel) findOperation(operationId string) (op *operationInProcess, found bool) {
+	op, found = f.opInProcess[operationId]
+	if found && !op.expiresAt.IsZero() && !time.Now().Before(op.expiresAt) {
+		f.removeOperation(op)
+		return nil, false
+	}
+	return op, found
+}
+
+// removeOperation removes the operation from the map and from the dependency index, and marks it deleted.
+// Must be called with the lock held, on an operation that was not deleted yet.
+// Once removed, the funnel holds no reference to the operation, so it can be garbage collected as soon as no
+// waiting goroutine refers to it.
+func (f *Funnel) removeOperation(operation *operationInProcess) {
+	// A concurrent execution is not held by the funnel until it provides the cached result.
+	if f.opInProcess[operation.operationId] == operation {
 		delete(f.opInProcess, operation.operationId)
-		operation.deleted.SetTo(true)
+		f.shrunk()
+	}
+	f.unregisterDeps(operation)
+	f.leaveGroup(operation)
+	if f.evictor != nil {
+		f.evictor.removed(operation)
+	}
+	if !operation.expiresAt.IsZero() { // The result was cached.
+		f.resultBytes -= operation.size
+		f.removedExpired(operation)
 	}
+	// The pending expiry would otherwise hold on to the operation until the cache time-to-live elapses.
+	f.unscheduleExpiry(operation)
+	operation.deleted.SetTo(true)
 }
 
 // Execute receives an identifier of the operation and a callback function to execute.
@@ -202,29 +1173,252 @@ func (f *Funnel) deleteOperation(operation *operationInProcess) {
 // All other requests (with the same identifier) will wait for the result of the first execution.
 // IMPORTANT: The returned object is shared between all the requesting callers.
 // Use ExecuteAndCopyResult to return a dedicated (copied) object.
-func (f *Funnel) Execute(operationId string, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
-	op := f.getOperationInProcess(operationId, opExeFunc)
+// The options apply to this request only, e.g. WithCallTimeout.
+func (f *Funnel) Execute(operationId string, opExeFunc func() (interface{}, error), options ...CallOption) (res interface{}, err error) {
+	call := callConfig{cost: 1}
+	for _, option := range options {
+		option(&call)
+	}
+	return f.execute(operationId, call, opExeFunc)
+}
 
-	res, err = op.wait(f.config.timeout) // Waiting for completion of operation
-	if err == timeoutError || !f.config.shouldCache(res, err) {
-		f.deleteOperation(op)
+// ExecuteWithFallback is like Execute, but returns the fallback value, without an error, when the request times out.
+// The operation is left in process rather than deleted, so that its execution completes and its result is cached for
+// the later requests (unless another request deletes it on its own timeout). Like with Execute, if the operation ended
+// with panic, ExecuteWithFallback panics the same way.
+func (f *Funnel) ExecuteWithFallback(operationId string, opExeFunc func() (interface{}, error), fallback interface{}) (interface{}, error) {
+	res, err := f.execute(operationId, callConfig{cost: 1, keepTimedOut: true}, opExeFunc)
+	if err == timeoutError {
+		return fallback, nil
 	}
+	return res, err
+}
+
+// ExecuteWithCost is like Execute, but when a concurrency budget is configured (see WithConcurrencyBudget) the execution
+// is admitted only once the sum of the costs of the operations executing concurrently, including this one, fits within the budget.
+// The cost is relevant only to the request that starts the execution; requests joining an operation in process don't pay it.
+// Execute uses a cost of 1. A cost of zero or less is never blocked by the budget, and a cost larger than the budget
+// is admitted once no other operation executes.
+func (f *Funnel) ExecuteWithCost(operationId string, cost int, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
+	return f.execute(operationId, callConfig{cost: cost}, opExeFunc)
+}
+
+// ExecuteDetailed is like Execute, but returns the error returned by the operation's function apart from the error that
+// prevented the delivery of a result to this request, so that they can be told apart. deliveryErr is ErrTimeout,
+// ErrColdCache (see WithColdMissAsync), ErrRateLimited (see WithPerKeyRate), ErrRejected (see WithAdmissionController),
+// ErrFunnelClosed (see Close) or a *CanceledError (see Cancel), in which case res and opErr are nil.
+// Otherwise opErr is the operation's own error, or ErrServedStale when a stale result is served (see WithServeStaleOnPanic).
+func (f *Funnel) ExecuteDetailed(operationId string, opExeFunc func() (interface{}, error)) (res interface{}, opErr error, deliveryErr error) {
+	return f.executeDetailed(operationId, callConfig{cost: 1}, opExeFunc)
+}
+
+// execute performs a request to the funnel with the given call configuration.
+func (f *Funnel) execute(operationId string, call callConfig, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
+	res, opErr, deliveryErr := f.executeDetailed(operationId, call, opExeFunc)
+	if deliveryErr != nil {
+		return nil, deliveryErr
+	}
+	return res, opErr
+}
+
+// executeDetailed is like execute, but returns the operation's error apart from the delivery error, see ExecuteDetailed.
+func (f *Funnel) executeDetailed(operationId string, call callConfig, opExeFunc func() (interface{}, error)) (res interface{}, opErr error, deliveryErr error) {
+	_, _, res, opErr, deliveryErr = f.executeOperation(operationId, call, opExeFunc)
 	return
 }
 
+// executeOperation is like executeDetailed, but also returns the operation whose result was delivered, if any, and
+// whether the request started its execution.
+func (f *Funnel) executeOperation(operationId string, call callConfig, opExeFunc func() (interface{}, error)) (op *operationInProcess, started bool, res interface{}, opErr error, deliveryErr error) {
+	requestTime := time.Now()
+	cfg := f.currentConfig()
+	call.synchronous = cfg.synchronous
+	call.awaits = true
+	op, started, err := f.startOperation(operationId, call, opExeFunc)
+	if err != nil {
+		return nil, false, nil, nil, err
+	}
+
+	// The latency of the delivered results, including their copy, is recorded apart for cache hits.
+	hit := !started && op.completed.IsSet()
+	defer func(start time.Time) {
+		if deliveryErr == nil {
+			f.counters.recordLatency(call.ctx, cfg.tracer, hit, time.Since(start))
+		}
+	}(requestTime)
+	if call.copyResult {
+		defer func() {
+			if res != nil {
+				if res, deliveryErr = f.copyResult(op, res); deliveryErr != nil {
+					opErr = nil
+				}
+			}
+		}()
+	}
+	if started && call.synchronous {
+		f.run(op, call, opExeFunc)
+	}
+	call.synchronous = false // Retries wait for the execution like any other request.
+
+	if op.config.coldMissAsync && !op.completed.IsSet() {
+		f.uncount(op) // The request doesn't wait for the operation after all.
+
+		// An operation that exceeded the timeout is abandoned the same way waiting on it would have, so that
+		// a stuck execution doesn't keep the cache cold forever.
+		if time.Since(op.startTime) >= op.config.timeout {
+			f.deleteOperation(op)
+			call.awaits = false
+			if _, err = f.getOperationInProcess(operationId, call, opExeFunc); err != nil {
+				return nil, false, nil, nil, err
+			}
+		}
+		return nil, false, nil, nil, ErrColdCache
+	}
+
+	for retries := 0; ; retries++ {
+		res, opErr, deliveryErr = f.await(call.waitContext(), op, call.waitTimeout(op), true) // Waiting for completion of operation
+		if deliveryErr != timeoutError {
+			return
+		}
+		if call.keepTimedOut || call.waitTimeout(op) < op.config.timeout {
+			// The operation is not late by the funnel's timeout (or should complete anyway), so it's left to the other
+			// requests.
+			return
+		}
+		f.deleteTimedOut(op)
+		f.wastedWait(op, requestTime)
+
+		// The timed out operation was deleted, so a retry waits on a fresh execution (or on one started meanwhile).
+		if retries == cfg.waiterRetries {
+			return
+		}
+		requestTime = time.Now()
+		if op, started, err = f.startOperation(operationId, call, opExeFunc); err != nil {
+			return nil, false, nil, nil, err
+		}
+	}
+}
+
+// wastedWait notifies the wasted wait handler, if any, when the request made at requestTime joined the timed out
+// operation rather than starting it. Such a request waited for less than the timeout, since the timeout is measured
+// from the start of the operation, and ended up with nothing.
+func (f *Funnel) wastedWait(op *operationInProcess, requestTime time.Time) {
+	if op.config.onWastedWait != nil && op.startTime.Before(requestTime) {
+		op.config.onWastedWait(op.operationId, time.Since(requestTime))
+	}
+}
+
+// deleteTimedOut deletes an operation that a waiting goroutine gave up on because of the timeout.
+func (f *Funnel) deleteTimedOut(op *operationInProcess) {
+	if f.deleteOperation(op) {
+		atomic.AddUint64(&f.counters.timeoutDeletions, 1)
+	}
+}
+
 // IMPORTANT: Only exported field values can be copied over.
+// With a copy cache (see WithCopyCache) the copy is made once per execution and shared by all the copy-callers it serves.
 func (f *Funnel) ExecuteAndCopyResult(operationId string, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
-	opRes, err := f.Execute(operationId, opExeFunc)
-	if opRes != nil {
-		res = deepcopy.Copy(opRes)
+	return f.execute(operationId, callConfig{cost: 1, copyResult: true}, opExeFunc)
+}
+
+// copyResult returns a copy of the result delivered by the operation to a copy-caller, or ErrCopyTimeout if the copy
+// took longer than the copy timeout.
+func (f *Funnel) copyResult(op *operationInProcess, res interface{}) (interface{}, error) {
+	copyRes := func() interface{} {
+		if op.config.copyCache {
+			return op.sharedCopy()
+		}
+		return deepcopy.Copy(res)
 	}
-	return res, err
+	if op.config.copyTimeout <= 0 {
+		return copyRes(), nil
+	}
+	return copyWithin(op.config.copyTimeout, copyRes)
+}
+
+// sharedCopy returns the copy of the operation's result, made by the first call.
+func (op *operationInProcess) sharedCopy() interface{} {
+	op.copyOnce.Do(func() {
+		op.copied = deepcopy.Copy(op.res)
+	})
+	return op.copied
 }
 
+// IsOpInProgress returns true if the funnel holds the operation, whether it's still executing or its result is cached.
+// Use IsExecuting to tell the operations still executing apart.
 func (f *Funnel) IsOpInProgress(operationId string) bool {
+	operationId = f.key(operationId)
+
 	f.Lock()
 	defer f.Unlock()
 
-	_, found := f.opInProcess[operationId]
+	_, found := f.findOperation(operationId)
 	return found
 }
+
+// IsExecuting returns true only if the operation is still executing, unlike IsOpInProgress that is true for a cached
+// result as well. An operation that ended with a panic is not executing.
+func (f *Funnel) IsExecuting(operationId string) bool {
+	operationId = f.key(operationId)
+
+	f.Lock()
+	op, found := f.findOperation(operationId)
+	f.Unlock()
+
+	if !found || op.completed.IsSet() {
+		return false
+	}
+	select {
+	case <-op.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// OperationAge returns the time elapsed since the operation was created, whether it's still executing or its result is
+// cached, e.g. to detect the operations stuck in process that are about to time out. The last value is false when the
+// funnel doesn't hold the operation.
+func (f *Funnel) OperationAge(operationId string) (time.Duration, bool) {
+	operationId = f.key(operationId)
+
+	f.Lock()
+	defer f.Unlock()
+
+	op, found := f.findOperation(operationId)
+	if !found {
+		return 0, false
+	}
+	return time.Since(op.startTime), true
+}
+
+// ForgetIf deletes the cached result of the operation only if the predicate returns true for it, so that the next request
+// for the same operation will re-execute it. Like Forget, it also forgets the operations which depend on it.
+// Returns true if the result was deleted.
+// The predicate is not called when the operation is still in process, or when its result is not cached, in which case nothing is deleted.
+// If the cached result is replaced (e.g. expired and re-executed) while the predicate is evaluated, the new result is kept.
+func (f *Funnel) ForgetIf(operationId string, pred func(res interface{}, err error) bool) bool {
+	operationId = f.key(operationId)
+
+	f.Lock()
+	op, found := f.findOperation(operationId)
+	f.Unlock()
+
+	if !found || !op.completed.IsSet() || !pred(op.res, op.err) {
+		return false
+	}
+
+	f.Lock()
+
+	// The result of a completed operation never changes, so the predicate still holds as long as this exact operation is cached.
+	if f.opInProcess[operationId] != op {
+		f.Unlock()
+		return false
+	}
+	forgotten := f.forget(operationId)
+	f.Unlock()
+
+	f.publishInvalidations(operationId)
+	f.deleteCached(forgotten)
+	return true
+}
@@ -1,14 +1,19 @@
 package funnel
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/intuit/funnel/internal/schedule"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -130,6 +135,35 @@ func TestWithShouldCachePredicate(t *testing.T) {
 	assert.Nil(t, op)
 }
 
+// The error of an operation that is not cached is delivered to all of its waiters, although the operation is deleted
+// as soon as it completes.
+func TestNotCachedErrorDeliveredToAllWaiters(t *testing.T) {
+	opErr := errors.New("something went wrong")
+	fnl := New(WithCacheTtl(time.Hour), WithShouldCachePredicate(func(response interface{}, err error) bool {
+		return err == nil
+	}))
+
+	release := make(chan empty)
+	numOfGoroutines := 100
+	errs := make(chan error, numOfGoroutines)
+	for i := 0; i < numOfGoroutines; i++ {
+		go func() {
+			_, err := fnl.Execute("opId", func() (interface{}, error) {
+				<-release
+				return nil, opErr
+			})
+			errs <- err
+		}()
+	}
+	assert.Eventually(t, func() bool { return fnl.Dump().Waiters == numOfGoroutines }, time.Second, time.Millisecond)
+	close(release)
+
+	for i := 0; i < numOfGoroutines; i++ {
+		assert.Equal(t, opErr, <-errs)
+	}
+	assert.False(t, fnl.IsOpInProgress("opId"))
+}
+
 func TestEndsWithPanic(t *testing.T) {
 	fnl := New()
 
@@ -384,3 +418,634 @@ func TestCachedValued(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestWithColdMissAsync(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithColdMissAsync(true))
+
+	var numOfExecutions uint64
+	release := make(chan empty)
+	operation := func() (interface{}, error) {
+		atomic.AddUint64(&numOfExecutions, 1)
+		<-release
+		return "warm", nil
+	}
+
+	var wg sync.WaitGroup
+	numOfGoroutines := 20
+	wg.Add(numOfGoroutines)
+	for i := 0; i < numOfGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			res, err := fnl.Execute("opId", operation)
+			assert.Nil(t, res)
+			assert.Equal(t, ErrColdCache, err)
+		}()
+	}
+	wg.Wait()
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		res, err := fnl.Execute("opId", operation)
+		return res == "warm" && err == nil
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&numOfExecutions))
+}
+
+func TestWithValidateSerializable(t *testing.T) {
+	var reportedId string
+	var reportedErr error
+	fnl := New(WithCacheTtl(time.Hour),
+		WithCodec(json.Marshal, func(b []byte) (interface{}, error) {
+			var v interface{}
+			err := json.Unmarshal(b, &v)
+			return v, err
+		}),
+		WithValidateSerializable(true),
+		WithOnInternalError(func(operationId string, err error) {
+			reportedId, reportedErr = operationId, err
+		}))
+
+	res, err := fnl.Execute("serializable", func() (interface{}, error) {
+		return "value", nil
+	})
+	assert.Equal(t, "value", res)
+	assert.Nil(t, err)
+	assert.True(t, fnl.IsOpInProgress("serializable"))
+	assert.Nil(t, reportedErr)
+
+	notSerializable := make(chan int)
+	res, err = fnl.Execute("notSerializable", func() (interface{}, error) {
+		return notSerializable, nil
+	})
+	assert.Equal(t, notSerializable, res)
+	assert.Nil(t, err)
+	assert.False(t, fnl.IsOpInProgress("notSerializable"))
+	assert.Equal(t, "notSerializable", reportedId)
+	var unsupported *json.UnsupportedTypeError
+	assert.True(t, errors.As(reportedErr, &unsupported))
+}
+
+func TestForgetIf(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	isStale := func(res interface{}, err error) bool {
+		return res == "stale"
+	}
+
+	fnl.Execute("opId", func() (interface{}, error) {
+		return "stale", nil
+	})
+	assert.True(t, fnl.ForgetIf("opId", isStale))
+	assert.False(t, fnl.IsOpInProgress("opId"))
+
+	// The entry was already refreshed to a current value, it must survive.
+	fnl.Execute("opId", func() (interface{}, error) {
+		return "current", nil
+	})
+	assert.False(t, fnl.ForgetIf("opId", isStale))
+	res, _ := fnl.Execute("opId", func() (interface{}, error) {
+		return "stale", nil
+	})
+	assert.Equal(t, "current", res)
+
+	assert.False(t, fnl.ForgetIf("nonexistent", isStale))
+}
+
+func TestWithName(t *testing.T) {
+	fnl1, fnl2 := New(), New()
+	assert.NotEqual(t, fnl1.Name(), fnl2.Name())
+
+	var reported []error
+	onInternalError := WithOnInternalError(func(operationId string, err error) {
+		reported = append(reported, err)
+	})
+	notSerializable := WithCodec(func(interface{}) ([]byte, error) {
+		return nil, errors.New("not serializable")
+	}, nil)
+	for _, name := range []string{"users", "orders"} {
+		fnl := New(WithName(name), notSerializable, WithValidateSerializable(true), onInternalError)
+		assert.Equal(t, name, fnl.Name())
+		fnl.Execute("opId", func() (interface{}, error) {
+			return "value", nil
+		})
+	}
+
+	assert.Len(t, reported, 2)
+	for i, name := range []string{"users", "orders"} {
+		var internalErr *InternalError
+		assert.True(t, errors.As(reported[i], &internalErr))
+		assert.Equal(t, name, internalErr.Funnel)
+		assert.Equal(t, "opId", internalErr.OperationId)
+		assert.True(t, strings.HasPrefix(reported[i].Error(), name+": "))
+	}
+}
+
+func TestWithColdMissAsyncPanic(t *testing.T) {
+	reported := make(chan error, 1)
+	fnl := New(WithCacheTtl(time.Hour), WithColdMissAsync(true), WithOnInternalError(func(operationId string, err error) {
+		reported <- err
+	}))
+
+	_, err := fnl.Execute("opId", func() (interface{}, error) {
+		panic("test ends with panic")
+	})
+	assert.Equal(t, ErrColdCache, err)
+	assert.Contains(t, (<-reported).Error(), "test ends with panic")
+
+	// The panicked operation isn't kept, the next request starts a new execution.
+	assert.Eventually(t, func() bool { return !fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+	fnl.Execute("opId", func() (interface{}, error) {
+		return "warm", nil
+	})
+	assert.Eventually(t, func() bool {
+		res, _ := fnl.Execute("opId", nil)
+		return res == "warm"
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestWithPanicFormatterReported(t *testing.T) {
+	reported := make(chan error, 1)
+	fnl := New(WithColdMissAsync(true), WithOnInternalError(func(operationId string, err error) {
+		reported <- err
+	}), WithPanicFormatter(func(recovered interface{}, stack []byte) error {
+		return errors.New("redacted")
+	}))
+
+	fnl.Execute("opId", func() (interface{}, error) {
+		panic("secret")
+	})
+	err := <-reported
+	assert.Contains(t, err.Error(), "redacted")
+	assert.NotContains(t, err.Error(), "secret")
+}
+
+func TestOrphanedExecutionPanicReported(t *testing.T) {
+	panicked := make(chan interface{}, 1)
+	reported := make(chan error, 1)
+	fnl := New(WithTimeout(time.Millisecond*10), WithOnPanic(func(operationId string, recovered interface{}) {
+		panicked <- recovered
+	}), WithOnInternalError(func(operationId string, err error) {
+		reported <- err
+	}))
+
+	release := make(chan empty)
+	_, err := fnl.Execute("opId", func() (interface{}, error) {
+		<-release
+		panic("orphaned panic")
+	})
+	assert.Equal(t, timeoutError, err)
+
+	// The execution panics once its waiter timed out and deleted the operation.
+	close(release)
+	assert.Equal(t, "orphaned panic", <-panicked)
+	assert.Contains(t, (<-reported).Error(), "orphaned panic")
+	assert.False(t, fnl.IsOpInProgress("opId"))
+}
+
+func TestWithColdMissAsyncRestartsStuckExecution(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithColdMissAsync(true), WithTimeout(time.Millisecond*50))
+
+	stuck := make(chan empty)
+	defer close(stuck)
+	_, err := fnl.Execute("opId", func() (interface{}, error) {
+		<-stuck
+		return "stuck", nil
+	})
+	assert.Equal(t, ErrColdCache, err)
+
+	// Past the timeout, the stuck execution is abandoned and a new one is started.
+	time.Sleep(time.Millisecond * 60)
+	var numOfExecutions uint64
+	_, err = fnl.Execute("opId", func() (interface{}, error) {
+		atomic.AddUint64(&numOfExecutions, 1)
+		return "restarted", nil
+	})
+	assert.Equal(t, ErrColdCache, err)
+
+	assert.Eventually(t, func() bool {
+		res, _ := fnl.Execute("opId", nil)
+		return res == "restarted"
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&numOfExecutions))
+}
+
+func TestWithValidateSerializableCodecFailures(t *testing.T) {
+	assert.Panics(t, func() { New(WithValidateSerializable(true)) }, "Validation without a codec should be rejected")
+
+	var reported []error
+	onInternalError := WithOnInternalError(func(operationId string, err error) {
+		reported = append(reported, err)
+	})
+	encode := func(v interface{}) ([]byte, error) {
+		return []byte("encoded"), nil
+	}
+
+	panickingCodec := WithCodec(func(interface{}) ([]byte, error) {
+		panic("codec panic")
+	}, nil)
+	fnl := New(WithCacheTtl(time.Hour), panickingCodec, WithValidateSerializable(true), onInternalError)
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return "value", nil
+	})
+	assert.Equal(t, "value", res, "A panicking codec should not fail the operation")
+	assert.Nil(t, err)
+	assert.False(t, fnl.IsOpInProgress("opId"))
+
+	failingDecoder := WithCodec(encode, func([]byte) (interface{}, error) {
+		return nil, errors.New("can't decode")
+	})
+	fnl = New(WithCacheTtl(time.Hour), failingDecoder, WithValidateSerializable(true), onInternalError)
+	fnl.Execute("opId", func() (interface{}, error) {
+		return "value", nil
+	})
+	assert.False(t, fnl.IsOpInProgress("opId"))
+
+	assert.Len(t, reported, 2)
+	assert.Contains(t, reported[0].Error(), "codec panic")
+	assert.Contains(t, reported[1].Error(), "can't decode")
+}
+
+func TestWithServeStaleOnPanic(t *testing.T) {
+	panics := make(chan interface{}, 1)
+	fnl := New(WithServeStaleOnPanic(true), WithOnPanic(func(operationId string, recovered interface{}) {
+		panics <- recovered
+	}))
+
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return "good", nil
+	})
+	assert.Equal(t, "good", res)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return !fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+
+	var wg sync.WaitGroup
+	numOfGoroutines := 10
+	wg.Add(numOfGoroutines)
+	for i := 0; i < numOfGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			res, err := fnl.Execute("opId", func() (interface{}, error) {
+				time.Sleep(time.Millisecond * 20)
+				panic("test ends with panic")
+			})
+			assert.Equal(t, "good", res)
+			assert.Equal(t, ErrServedStale, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, "test ends with panic", <-panics)
+
+	// Without a good result there is nothing to serve, the panic propagates.
+	assert.Panics(t, func() {
+		fnl.Execute("other", func() (interface{}, error) {
+			panic("test ends with panic")
+		})
+	})
+	<-panics
+
+	// Once forgotten, the last good result isn't served anymore.
+	fnl.Forget("opId")
+	assert.Panics(t, func() {
+		fnl.Execute("opId", func() (interface{}, error) {
+			panic("test ends with panic")
+		})
+	})
+}
+
+func TestWithPanicAsError(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithPanicAsError(func(recovered interface{}) error {
+		return fmt.Errorf("recovered: %v", recovered)
+	}))
+
+	var wg sync.WaitGroup
+	numOfGoroutines := 10
+	wg.Add(numOfGoroutines)
+	for i := 0; i < numOfGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			res, err := fnl.Execute("opId", func() (interface{}, error) {
+				time.Sleep(time.Millisecond * 20)
+				panic("test ends with panic")
+			})
+			assert.Nil(t, res)
+			assert.EqualError(t, err, "recovered: test ends with panic")
+		}()
+	}
+	wg.Wait()
+
+	// The error is not cached.
+	assert.False(t, fnl.IsOpInProgress("opId"))
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return "res", nil
+	})
+	assert.Equal(t, "res", res)
+	assert.Nil(t, err)
+}
+
+func TestShortCacheTtlNeverServedPastExpiry(t *testing.T) {
+	// The expiry of the first result is held before it deletes the operation, as if it ran late.
+	gate := newPointGate(schedule.BeforeDelete)
+	defer close(gate.release)
+	fnl := New(WithCacheTtl(time.Millisecond), gate.option())
+
+	var numOfExecutions int32
+	opExeFunc := func() (interface{}, error) {
+		return atomic.AddInt32(&numOfExecutions, 1), nil
+	}
+
+	res, err := fnl.Execute("opId", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), res)
+	<-gate.reached
+
+	assert.False(t, fnl.IsOpInProgress("opId"))
+	_, _, status := fnl.Lookup("opId")
+	assert.Equal(t, StatusMiss, status)
+	res, err = fnl.Execute("opId", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), res)
+}
+
+func TestWithWaiterRetries(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond*20), WithWaiterRetries(2))
+
+	var numOfExecutions int32
+	release := make(chan empty)
+	defer close(release)
+	start := time.Now()
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		if atomic.AddInt32(&numOfExecutions, 1) == 1 {
+			<-release // The first execution is stuck, the retry succeeds on a fresh one.
+		}
+		return "res", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "res", res)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&numOfExecutions))
+	assert.True(t, time.Since(start) >= time.Millisecond*20)
+	assert.Equal(t, uint64(1), fnl.Stats().TimeoutDeletions)
+
+	// Once the retries are exhausted, the timeout is returned.
+	start = time.Now()
+	_, err = fnl.Execute("stuck", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	assert.Equal(t, timeoutError, err)
+	assert.True(t, time.Since(start) >= time.Millisecond*60)
+	assert.Equal(t, uint64(4), fnl.Stats().TimeoutDeletions)
+}
+
+func TestWithOnWastedWait(t *testing.T) {
+	type wastedWait struct {
+		operationId string
+		waited      time.Duration
+	}
+	wastedWaits := make(chan wastedWait, 2)
+	fnl := New(WithTimeout(time.Millisecond*50), WithOnWastedWait(func(operationId string, waited time.Duration) {
+		wastedWaits <- wastedWait{operationId, waited}
+	}))
+
+	release := make(chan empty)
+	defer close(release)
+	opExeFunc := func() (interface{}, error) {
+		<-release
+		return nil, nil
+	}
+
+	// The request starting the operation waits the whole timeout, it's not a wasted wait.
+	started := make(chan empty)
+	go func() {
+		defer close(started)
+		fnl.Execute("opId", opExeFunc)
+	}()
+
+	time.Sleep(time.Millisecond * 40)
+	_, err := fnl.Execute("opId", opExeFunc)
+	assert.Equal(t, timeoutError, err)
+	<-started
+
+	ww := <-wastedWaits
+	assert.Equal(t, "opId", ww.operationId)
+	assert.True(t, ww.waited < time.Millisecond*50, "late joiner waited %v", ww.waited)
+	assert.Len(t, wastedWaits, 0)
+}
+
+func TestCancellationNotCached(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var numOfExecutions int32
+	opExeFunc := func() (interface{}, error) {
+		if atomic.AddInt32(&numOfExecutions, 1) == 1 {
+			return nil, fmt.Errorf("fetching: %w", ctx.Err())
+		}
+		return "res", nil
+	}
+
+	_, err := fnl.Execute("opId", opExeFunc)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, fnl.IsOpInProgress("opId"))
+
+	res, err := fnl.Execute("opId", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, "res", res)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&numOfExecutions))
+
+	_, err = fnl.Execute("deadline", func() (interface{}, error) {
+		return nil, context.DeadlineExceeded
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.False(t, fnl.IsOpInProgress("deadline"))
+}
+
+func TestWithCacheableError(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errUnavailable := errors.New("unavailable")
+	fnl := New(WithCacheTtl(time.Hour), WithCacheableError(func(err error) bool {
+		return errors.Is(err, errNotFound)
+	}))
+
+	var numOfExecutions int32
+	failing := func(err error) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			atomic.AddInt32(&numOfExecutions, 1)
+			return nil, err
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := fnl.Execute("missing", failing(errNotFound))
+		assert.Equal(t, errNotFound, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&numOfExecutions))
+
+	for i := 0; i < 3; i++ {
+		_, err := fnl.Execute("flaky", failing(fmt.Errorf("fetching: %w", errUnavailable)))
+		assert.True(t, errors.Is(err, errUnavailable))
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&numOfExecutions))
+
+	// Successful results are cached regardless.
+	fnl.Execute("ok", failing(nil))
+	fnl.Execute("ok", failing(nil))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&numOfExecutions))
+}
+
+func TestWithNegativeCacheTtl(t *testing.T) {
+	negativeCacheTtl := time.Millisecond * 30
+	fnl := New(WithCacheTtl(time.Hour), WithNegativeCacheTtl(negativeCacheTtl))
+
+	opErr := errors.New("not found")
+	fnl.Execute("failed", func() (interface{}, error) { return nil, opErr })
+	fnl.Execute("ok", func() (interface{}, error) { return "res", nil })
+	assert.True(t, fnl.IsOpInProgress("failed"))
+
+	time.Sleep(negativeCacheTtl * 2)
+	assert.False(t, fnl.IsOpInProgress("failed"))
+	assert.True(t, fnl.IsOpInProgress("ok"))
+
+	// Errors are not cached at all with a negative time to live of 0.
+	noNegative := New(WithCacheTtl(time.Hour), WithNegativeCacheTtl(0))
+	noNegative.Execute("failed", func() (interface{}, error) { return nil, opErr })
+	noNegative.Execute("ok", func() (interface{}, error) { return "res", nil })
+	assert.False(t, noNegative.IsOpInProgress("failed"))
+	assert.True(t, noNegative.IsOpInProgress("ok"))
+
+	// Panics are never cached with negative caching.
+	assert.Panics(t, func() {
+		fnl.Execute("panicked", func() (interface{}, error) { panic("test ends with panic") })
+	})
+	assert.False(t, fnl.IsOpInProgress("panicked"))
+	res, err := fnl.Execute("panicked", func() (interface{}, error) { return "recovered", nil })
+	assert.Equal(t, "recovered", res)
+	assert.Nil(t, err)
+}
+
+func TestIsExecuting(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	go fnl.Execute("opId", func() (interface{}, error) {
+		<-release
+		return "res", nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsExecuting("opId") }, time.Second, time.Millisecond)
+	assert.True(t, fnl.IsOpInProgress("opId"))
+
+	close(release)
+	assert.Eventually(t, func() bool { return !fnl.IsExecuting("opId") }, time.Second, time.Millisecond)
+	assert.True(t, fnl.IsOpInProgress("opId"), "the cached result is still held")
+
+	assert.Panics(t, func() {
+		fnl.Execute("panicked", func() (interface{}, error) { panic("test ends with panic") })
+	})
+	assert.False(t, fnl.IsExecuting("panicked"))
+	assert.False(t, fnl.IsExecuting("nonexistent"))
+}
+
+func TestOperationAge(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	go fnl.Execute("opId", func() (interface{}, error) {
+		<-release
+		return "res", nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsExecuting("opId") }, time.Second, time.Millisecond)
+	time.Sleep(time.Millisecond * 20)
+	age, ok := fnl.OperationAge("opId")
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, age, time.Millisecond*20)
+
+	close(release)
+	assert.Eventually(t, func() bool { return !fnl.IsExecuting("opId") }, time.Second, time.Millisecond)
+	cachedAge, ok := fnl.OperationAge("opId")
+	assert.True(t, ok, "the cached result is still held")
+	assert.Greater(t, cachedAge, age)
+
+	_, ok = fnl.OperationAge("nonexistent")
+	assert.False(t, ok)
+}
+
+func TestExecuteWithFallback(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithTimeout(time.Millisecond*20))
+
+	completed := make(chan empty)
+	res, err := fnl.ExecuteWithFallback("slow", func() (interface{}, error) {
+		defer close(completed)
+		time.Sleep(time.Millisecond * 50)
+		return "res", nil
+	}, "fallback")
+	assert.Equal(t, "fallback", res)
+	assert.Nil(t, err)
+
+	// The execution completes for the later requests.
+	<-completed
+	assert.Eventually(t, func() bool { return !fnl.IsExecuting("slow") }, time.Second, time.Millisecond)
+	res, err = fnl.ExecuteWithFallback("slow", nil, "fallback")
+	assert.Equal(t, "res", res)
+	assert.Nil(t, err)
+
+	_, err = fnl.ExecuteWithFallback("failed", func() (interface{}, error) {
+		return nil, errors.New("failed")
+	}, "fallback")
+	assert.EqualError(t, err, "failed")
+	assert.Panics(t, func() {
+		fnl.ExecuteWithFallback("panicked", func() (interface{}, error) { panic("test ends with panic") }, "fallback")
+	})
+}
+
+// auditSinkFunc adapts a function to the AuditSink interface.
+type auditSinkFunc func(rec AuditRecord)
+
+func (fn auditSinkFunc) Record(rec AuditRecord) { fn(rec) }
+
+// User code is never called while holding the funnel's lock, so a slow handler doesn't stall the other operations.
+func TestSlowHandlersDontBlockOtherOperations(t *testing.T) {
+	blocked := make(chan empty)
+	defer close(blocked)
+	var numOfBlocked int32
+	block := func(operationId string) {
+		if strings.HasPrefix(operationId, "slow") {
+			atomic.AddInt32(&numOfBlocked, 1)
+			<-blocked
+		}
+	}
+	fnl := New(WithCacheTtl(time.Hour),
+		WithKeyExtractor(func(rawKey string) string {
+			if rawKey == "slow-dep" {
+				block(rawKey)
+			}
+			return rawKey
+		}),
+		WithOnPanic(func(operationId string, recovered interface{}) { block(operationId) }),
+		WithAuditSink(auditSinkFunc(func(rec AuditRecord) { block(rec.OperationId) })),
+		WithOnFirstSeen(func(operationId string) { block(operationId) }),
+	)
+
+	go fnl.ExecuteWithDeps("other", []string{"slow-dep"}, func() (interface{}, error) { return nil, nil })
+	go fnl.Execute("slow-audited", func() (interface{}, error) { return nil, nil })
+	go func() {
+		defer func() { recover() }()
+		fnl.Execute("slow-panicked", func() (interface{}, error) { panic("test ends with panic") })
+	}()
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&numOfBlocked) < 5; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the handlers to be called without blocking each other")
+		}
+	}
+
+	done := make(chan empty)
+	go func() {
+		defer close(done)
+		fnl.Execute("fast", func() (interface{}, error) { return nil, nil })
+		fnl.Forget("fast")
+		fnl.Stats()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected the other operations not to be blocked by the slow handlers")
+	}
+}
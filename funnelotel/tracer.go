@@ -0,0 +1,74 @@
+// Package funnelotel adapts OpenTelemetry tracing to funnel, tracing the executions of the operations as spans.
+package funnelotel
+
+import (
+	"context"
+
+	"github.com/intuit/funnel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// SpanName is the name of the spans of the executions.
+	SpanName = "funnel.execute"
+
+	// RequestEvent is the name of the event recorded on the span of each request that started or joined an execution.
+	RequestEvent = "funnel.request"
+
+	// OperationIdKey, OutcomeKey and LeaderKey are the attributes of the spans and of the events: the identifier
+	// of the operation, the outcome of the execution (see funnel.Outcome) and whether the request started the execution.
+	OperationIdKey = attribute.Key("funnel.operation_id")
+	OutcomeKey     = attribute.Key("funnel.outcome")
+	LeaderKey      = attribute.Key("funnel.leader")
+)
+
+// Tracer is a funnel.Tracer that starts a span of the tracer for each execution, a child of the span of the request
+// that started it, and records an event on the span of each request that started or joined an execution. The duration
+// of the execution is the duration of its span.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a funnel.Tracer starting its spans with the tracer, see funnel.WithTracer.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// StartExecution starts the span of the execution of the operation, and returns the context carrying it, so that the
+// spans started by the execution are its children.
+func (t *Tracer) StartExecution(ctx context.Context, operationId string) (context.Context, funnel.ExecutionSpan) {
+	ctx, span := t.tracer.Start(ctx, SpanName, trace.WithAttributes(OperationIdKey.String(operationId)))
+	return ctx, executionSpan{span: span}
+}
+
+// Requested records the request as an event on its span, if any.
+func (t *Tracer) Requested(ctx context.Context, operationId string, leader bool) {
+	trace.SpanFromContext(ctx).AddEvent(RequestEvent, trace.WithAttributes(OperationIdKey.String(operationId), LeaderKey.Bool(leader)))
+}
+
+// TraceIDs returns the identifiers of the trace and of the span of the context, if valid.
+func (t *Tracer) TraceIDs(ctx context.Context) (traceId, spanId string, ok bool) {
+	span := trace.SpanContextFromContext(ctx)
+	if !span.IsValid() {
+		return "", "", false
+	}
+	return span.TraceID().String(), span.SpanID().String(), true
+}
+
+// executionSpan is the span of an execution, ended with its outcome.
+type executionSpan struct {
+	span trace.Span
+}
+
+func (s executionSpan) End(outcome funnel.Outcome, err error) {
+	s.span.SetAttributes(OutcomeKey.String(outcome.String()))
+	if err != nil {
+		s.span.RecordError(err)
+	}
+	if outcome != funnel.OutcomeSuccess {
+		s.span.SetStatus(codes.Error, outcome.String())
+	}
+	s.span.End()
+}
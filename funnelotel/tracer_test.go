@@ -0,0 +1,85 @@
+package funnelotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/intuit/funnel"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	fnl := funnel.New(funnel.WithTracer(NewTracer(tracer)))
+
+	ctx, request := tracer.Start(context.Background(), "request")
+	release := make(chan struct{})
+	go fnl.ExecuteContext(ctx, "opId", func(ctx context.Context) (interface{}, error) {
+		<-release
+		_, child := tracer.Start(ctx, "child")
+		child.End()
+		return nil, errors.New("failed")
+	})
+	assert.Eventually(t, func() bool { return fnl.IsExecuting("opId") }, time.Second, time.Millisecond)
+
+	joinCtx, joining := tracer.Start(context.Background(), "joining")
+	joined := make(chan struct{})
+	go func() {
+		defer close(joined)
+		fnl.ExecuteContext(joinCtx, "opId", nil)
+	}()
+	assert.Eventually(t, func() bool { return fnl.Dump().Waiters == 2 }, time.Second, time.Millisecond)
+	close(release)
+	<-joined
+	request.End()
+	joining.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	execution := spans[SpanName]
+	if !assert.NotNil(t, execution) {
+		return
+	}
+	assert.Equal(t, request.SpanContext().SpanID(), execution.Parent().SpanID(), "the execution is a child of the leader's request")
+	assert.Equal(t, execution.SpanContext().SpanID(), spans["child"].Parent().SpanID(), "the spans of the execution are its children")
+	assert.Contains(t, execution.Attributes(), OperationIdKey.String("opId"))
+	assert.Contains(t, execution.Attributes(), OutcomeKey.String("error"))
+	assert.Equal(t, codes.Error, execution.Status().Code)
+
+	for name, leader := range map[string]bool{"request": true, "joining": false} {
+		events := spans[name].Events()
+		if assert.Len(t, events, 1, name) {
+			assert.Equal(t, RequestEvent, events[0].Name)
+			assert.Contains(t, events[0].Attributes, attribute.Bool(string(LeaderKey), leader))
+		}
+	}
+}
+
+func TestTracerExemplars(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	fnl := funnel.New(funnel.WithTracer(NewTracer(tracer)))
+
+	ctx, span := tracer.Start(context.Background(), "request")
+	fnl.ExecuteContext(ctx, "opId", func(context.Context) (interface{}, error) { return nil, nil })
+	span.End()
+
+	var exemplars []*funnel.Exemplar
+	for _, exemplar := range fnl.Stats().MissLatency.Exemplars {
+		if exemplar != nil {
+			exemplars = append(exemplars, exemplar)
+		}
+	}
+	if assert.Len(t, exemplars, 1) {
+		assert.Equal(t, span.SpanContext().TraceID().String(), exemplars[0].TraceId)
+		assert.Equal(t, span.SpanContext().SpanID().String(), exemplars[0].SpanId)
+	}
+}
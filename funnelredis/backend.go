@@ -0,0 +1,109 @@
+// Package funnelredis implements a funnel.Backend over Redis pub/sub, broadcasting the invalidations of the operations
+// between the funnels of several instances sharing a Redis channel.
+package funnelredis
+
+import (
+	"context"
+	"sync"
+
+	"github.com/intuit/funnel"
+	"github.com/redis/go-redis/v9"
+)
+
+// Backend is a funnel.Backend that publishes the invalidations on a Redis channel, and receives them from it (see
+// funnel.WithBackend). Redis delivers the invalidations to the subscribers, so that a slow subscriber doesn't block the
+// publishers.
+type Backend struct {
+	client  redis.UniversalClient
+	channel string
+	onError func(error)
+
+	mu            sync.Mutex
+	subscriptions map[<-chan string]*subscription
+}
+
+// subscription forwards the payloads of the messages of a Redis subscription to the funnel, until unsubscribed.
+type subscription struct {
+	pubsub *redis.PubSub
+	done   chan struct{}
+}
+
+var _ funnel.Backend = (*Backend)(nil)
+
+// NewBackend returns a backend broadcasting the invalidations on the channel through the client. The failures to
+// subscribe or to publish are passed to onError, if not nil.
+func NewBackend(client redis.UniversalClient, channel string, onError func(error)) *Backend {
+	return &Backend{
+		client:        client,
+		channel:       channel,
+		onError:       onError,
+		subscriptions: map[<-chan string]*subscription{},
+	}
+}
+
+// Subscribe subscribes to the channel, and returns the channel of the invalidations received from it. It waits for
+// Redis to confirm the subscription, so that the invalidations published from now on are received. The client
+// resubscribes after a failure.
+func (b *Backend) Subscribe() <-chan string {
+	pubsub := b.client.Subscribe(context.Background(), b.channel)
+	if _, err := pubsub.Receive(context.Background()); err != nil {
+		b.report(err)
+	}
+
+	invalidations := make(chan string)
+	s := &subscription{pubsub: pubsub, done: make(chan struct{})}
+	go s.forward(pubsub.Channel(), invalidations)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscriptions[invalidations] = s
+	return invalidations
+}
+
+// Unsubscribe closes the Redis subscription, and the channel of the invalidations.
+func (b *Backend) Unsubscribe(invalidations <-chan string) {
+	b.mu.Lock()
+	s, ok := b.subscriptions[invalidations]
+	delete(b.subscriptions, invalidations)
+	b.mu.Unlock()
+
+	if ok {
+		close(s.done)
+		if err := s.pubsub.Close(); err != nil {
+			b.report(err)
+		}
+	}
+}
+
+// PublishInvalidation publishes the identifier of the operation on the channel.
+func (b *Backend) PublishInvalidation(operationId string) {
+	if err := b.client.Publish(context.Background(), b.channel, operationId).Err(); err != nil {
+		b.report(err)
+	}
+}
+
+func (b *Backend) report(err error) {
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
+
+func (s *subscription) forward(messages <-chan *redis.Message, invalidations chan<- string) {
+	defer close(invalidations)
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			select {
+			case invalidations <- message.Payload:
+			case <-s.done:
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package funnelredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/intuit/funnel"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackend(t *testing.T) {
+	server := miniredis.RunT(t)
+	newBackend := func() *Backend {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewBackend(client, "invalidations", func(err error) { t.Error(err) })
+	}
+
+	fnl1 := funnel.New(funnel.WithCacheTtl(time.Hour), funnel.WithBackend(newBackend()))
+	fnl2 := funnel.New(funnel.WithCacheTtl(time.Hour), funnel.WithBackend(newBackend()))
+	defer fnl1.Close()
+
+	opExeFunc := func() (interface{}, error) { return "cached", nil }
+	for _, fnl := range []*funnel.Funnel{fnl1, fnl2} {
+		fnl.Execute("opId", opExeFunc)
+		fnl.Execute("unrelated", opExeFunc)
+	}
+	assert.Equal(t, map[string]int{"invalidations": 2}, server.PubSubNumSub("invalidations"))
+
+	fnl1.Forget("opId")
+
+	assert.Eventually(t, func() bool {
+		return !fnl2.IsOpInProgress("opId")
+	}, time.Second, time.Millisecond, "the invalidation should have been received by the other funnel")
+	assert.True(t, fnl2.IsOpInProgress("unrelated"))
+
+	fnl2.Close()
+	assert.Eventually(t, func() bool {
+		return server.PubSubNumSub("invalidations")["invalidations"] == 1
+	}, time.Second, time.Millisecond, "the closed funnel should have unsubscribed")
+}
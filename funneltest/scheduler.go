@@ -0,0 +1,97 @@
+// Package funneltest provides utilities for testing code that uses funnel, and funnel itself, deterministically.
+package funneltest
+
+import (
+	"sync"
+
+	"github.com/intuit/funnel"
+	"github.com/intuit/funnel/internal/schedule"
+)
+
+// SchedulePoint identifies a point in an operation's lifecycle at which the Scheduler is consulted.
+type SchedulePoint = schedule.Point
+
+const (
+	// BeforeExecute is reached by the execution goroutine right before the operation's function is invoked.
+	BeforeExecute = schedule.BeforeExecute
+
+	// BeforeClose is reached once the operation's function returned (or panicked), before its result is published.
+	BeforeClose = schedule.BeforeClose
+
+	// BeforeDelete is reached before a single operation is deleted from the funnel because it timed out or its cache
+	// time-to-live expired. It is not reached when a result that should not be cached is dropped
+	// as the operation completes, nor by Forget and ForgetIf.
+	BeforeDelete = schedule.BeforeDelete
+)
+
+// Scheduler lets a test pause operations at points of their lifecycle.
+// Install it with WithScheduler and use Hold to register the pauses. Points without a registered pause are passed through.
+type Scheduler struct {
+	sync.Mutex
+	gates map[gateKey][]*Gate
+}
+
+type gateKey struct {
+	point       SchedulePoint
+	operationId string
+}
+
+// Gate is a single pause registered with Hold.
+type Gate struct {
+	reached chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+// NewScheduler returns a Scheduler without any registered pause.
+func NewScheduler() *Scheduler {
+	return &Scheduler{gates: make(map[gateKey][]*Gate)}
+}
+
+// Hold makes the next operation with the given id that reaches point block until the returned gate is released.
+// Several holds on the same point and id apply to successive arrivals, in registration order.
+func (s *Scheduler) Hold(point SchedulePoint, operationId string) *Gate {
+	g := &Gate{reached: make(chan struct{}), release: make(chan struct{})}
+
+	s.Lock()
+	defer s.Unlock()
+	key := gateKey{point, operationId}
+	s.gates[key] = append(s.gates[key], g)
+	return g
+}
+
+// WithScheduler returns an option installing the scheduler in the funnel created with it.
+func WithScheduler(s *Scheduler) funnel.Option {
+	return schedule.WithScheduler(s).(funnel.Option)
+}
+
+// Reach is called by the funnel when an operation reaches a point of its lifecycle.
+func (s *Scheduler) Reach(point SchedulePoint, operationId string) {
+	s.Lock()
+	key := gateKey{point, operationId}
+	gates := s.gates[key]
+	if len(gates) == 0 {
+		s.Unlock()
+		return
+	}
+	g := gates[0]
+	if len(gates) == 1 {
+		delete(s.gates, key)
+	} else {
+		s.gates[key] = gates[1:]
+	}
+	s.Unlock()
+
+	close(g.reached)
+	<-g.release
+}
+
+// Reached returns a channel that is closed once an operation arrived at the gate and is blocked on it.
+func (g *Gate) Reached() <-chan struct{} {
+	return g.reached
+}
+
+// Release lets the operation blocked on the gate, or the one that will arrive at it, continue. It is safe to call more than once.
+func (g *Gate) Release() {
+	g.once.Do(func() { close(g.release) })
+}
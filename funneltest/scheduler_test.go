@@ -0,0 +1,53 @@
+package funneltest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intuit/funnel"
+)
+
+/*
+An execution that outlives its timeout is deleted from the funnel and an identical operation can be recreated while
+the first execution is still running. Once the orphaned execution completes it must not affect the recreated operation.
+*/
+func TestOrphanedExecutionDoesNotAffectRecreatedOperation(t *testing.T) {
+	sched := NewScheduler()
+	fnl := funnel.New(funnel.WithTimeout(time.Millisecond*50), funnel.WithCacheTtl(time.Hour), WithScheduler(sched))
+
+	orphanExecute := sched.Hold(BeforeExecute, "opId")
+	defer orphanExecute.Release()
+
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return "orphan", nil
+	})
+	if res != nil || err == nil {
+		t.Fatal("Expected the first execution to time out, got ", res, err)
+	}
+	<-orphanExecute.Reached()
+
+	res, err = fnl.Execute("opId", func() (interface{}, error) {
+		return "recreated", nil
+	})
+	if res != "recreated" || err != nil {
+		t.Fatal("Expected the recreated operation to complete, got ", res, err)
+	}
+
+	// Let the orphaned execution run only now that the recreated operation is cached.
+	orphanDelete := sched.Hold(BeforeDelete, "opId")
+	defer orphanDelete.Release()
+	orphanExecute.Release()
+
+	select {
+	case <-orphanDelete.Reached():
+		t.Fatal("The orphaned execution should not delete the recreated operation")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	res, err = fnl.Execute("opId", func() (interface{}, error) {
+		return "executed again", nil
+	})
+	if res != "recreated" || err != nil {
+		t.Error("Expected the recreated operation's result to remain cached, got ", res, err)
+	}
+}
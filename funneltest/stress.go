@@ -0,0 +1,210 @@
+package funneltest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/intuit/funnel"
+)
+
+// StressConfig configures the requests made by Stress. The zero value of a field selects its default.
+type StressConfig struct {
+	// The number of goroutines making requests concurrently, 8 by default, and the number of requests each of them
+	// makes, 1000 by default.
+	Goroutines int
+	Requests   int
+
+	// The number of distinct operation identifiers requested, 16 by default. Fewer identifiers mean more coalescing.
+	Ids int
+
+	// The maximum duration of an execution, each one sleeping for a random duration up to it, 1ms by default.
+	ExecDelay time.Duration
+
+	// The fraction of the executions that sleep for SlowDelay instead, e.g. to exceed the funnel's timeout.
+	SlowRate  float64
+	SlowDelay time.Duration
+
+	// The fraction of the executions that panic, and of those that return an error.
+	PanicRate float64
+	ErrorRate float64
+
+	// The fraction of the requests that forget their operation (see Funnel.Forget) instead of executing it.
+	ForgetRate float64
+
+	// The seed of the random choices, so that a failing run can be replayed (up to the goroutines' interleaving).
+	Seed int64
+}
+
+// StressReport counts what happened during a Stress run.
+type StressReport struct {
+	// The number of requests executing an operation, and of the ones forgetting one.
+	Requests int
+	Forgets  int
+
+	// The number of executions of the operations, and of the ones that panicked.
+	Executions int
+	Panics     int
+
+	// The number of requests that received no result (e.g. timed out), see Funnel.ExecuteDetailed.
+	Undelivered int
+}
+
+// stressResult is the result of the executions of the operation with the identifier.
+type stressResult struct {
+	id string
+}
+
+// stressPanic is the value the executions of the operation with the identifier panic with.
+type stressPanic struct {
+	id string
+}
+
+// errStress is the error returned by the executions failing on purpose.
+var errStress = errors.New("Execution failed on purpose")
+
+// Stress hammers the funnel with concurrent requests as configured, waits for the executions to return, and checks
+// the funnel's invariants. It returns what happened and an error joining the violations of the invariants,
+// if any:
+//   - each request receives the result, or the panic, of an execution of its own operation;
+//   - each operation is closed once: no execution completes cleanly more than once (see funnel.Stats);
+//   - each timed out operation is deleted once, by one of the requests that received no result;
+//   - nothing is orphaned once the executions returned: no goroutine still waits, and the funnel holds at most one
+//     operation per identifier.
+//
+// Run it under the race detector, which reports the unsynchronized accesses that the run exposed; a double close of an
+// operation crashes the process. The funnel should not be used by anything else during the run. For example:
+//
+//	fnl := funnel.New(funnel.WithTimeout(time.Millisecond*5), funnel.WithCacheTtl(time.Millisecond))
+//	report, err := funneltest.Stress(fnl, funneltest.StressConfig{PanicRate: 0.01, SlowRate: 0.01, SlowDelay: time.Millisecond * 10})
+func Stress(fnl *funnel.Funnel, cfg StressConfig) (StressReport, error) {
+	cfg = cfg.withDefaults()
+	statsBefore := fnl.Stats()
+
+	var (
+		requesters sync.WaitGroup
+
+		mutex      sync.Mutex
+		report     StressReport
+		violations []error
+	)
+	violation := func(err error) {
+		mutex.Lock()
+		violations = append(violations, err)
+		mutex.Unlock()
+	}
+
+	var numOfExecutions, numOfPanics, running int64
+	for g := 0; g < cfg.Goroutines; g++ {
+		requesters.Add(1)
+		go func(rnd *rand.Rand) {
+			defer requesters.Done()
+
+			var requests, forgets, undelivered int
+			for i := 0; i < cfg.Requests; i++ {
+				id := fmt.Sprintf("stress-%d", rnd.Intn(cfg.Ids))
+				if rnd.Float64() < cfg.ForgetRate {
+					fnl.Forget(id)
+					forgets++
+					continue
+				}
+
+				// The execution's random choices are made by the request, since its goroutine doesn't own rnd.
+				delay := time.Duration(rnd.Int63n(int64(cfg.ExecDelay) + 1))
+				if rnd.Float64() < cfg.SlowRate {
+					delay = cfg.SlowDelay
+				}
+				outcome := rnd.Float64()
+
+				requests++
+				res, opErr, deliveryErr, recovered := request(fnl, id, func() (interface{}, error) {
+					atomic.AddInt64(&running, 1)
+					defer atomic.AddInt64(&running, -1)
+					atomic.AddInt64(&numOfExecutions, 1)
+					time.Sleep(delay)
+					switch {
+					case outcome < cfg.PanicRate:
+						atomic.AddInt64(&numOfPanics, 1)
+						panic(stressPanic{id})
+					case outcome < cfg.PanicRate+cfg.ErrorRate:
+						return nil, errStress
+					}
+					return stressResult{id}, nil
+				})
+				switch {
+				case recovered != nil:
+					if p, ok := recovered.(stressPanic); !ok || p.id != id {
+						violation(fmt.Errorf("request for %s panicked with %v", id, recovered))
+					}
+				case deliveryErr != nil:
+					undelivered++
+				case res != nil && res != (stressResult{id}):
+					violation(fmt.Errorf("request for %s received %v with the error %v", id, res, opErr))
+				}
+			}
+
+			mutex.Lock()
+			report.Requests += requests
+			report.Forgets += forgets
+			report.Undelivered += undelivered
+			mutex.Unlock()
+		}(rand.New(rand.NewSource(cfg.Seed + int64(g))))
+	}
+	requesters.Wait()
+
+	// The executions outliving their requests (e.g. timed out) are waited for, and the ones not started yet (e.g. waiting
+	// for the concurrency budget) are given a short while to start.
+	for quiet := 0; quiet < 10; quiet++ {
+		if atomic.LoadInt64(&running) > 0 {
+			quiet = 0
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	report.Executions = int(atomic.LoadInt64(&numOfExecutions))
+	report.Panics = int(atomic.LoadInt64(&numOfPanics))
+	stats := fnl.Stats()
+	if cleanCompletions := int(stats.CleanCompletions - statsBefore.CleanCompletions); cleanCompletions > report.Executions-report.Panics {
+		violation(fmt.Errorf("%d clean completions for %d executions that didn't panic", cleanCompletions, report.Executions-report.Panics))
+	}
+	if timeoutDeletions := int(stats.TimeoutDeletions - statsBefore.TimeoutDeletions); timeoutDeletions > report.Undelivered {
+		violation(fmt.Errorf("%d timeout deletions for %d requests that received no result", timeoutDeletions, report.Undelivered))
+	}
+	dump := fnl.Dump()
+	if dump.Waiters != 0 {
+		violation(fmt.Errorf("%d goroutines still waiting", dump.Waiters))
+	}
+	if dump.Operations > cfg.Ids {
+		violation(fmt.Errorf("%d operations held for %d identifiers", dump.Operations, cfg.Ids))
+	}
+	return report, errors.Join(violations...)
+}
+
+// request executes the operation, recovering the panic it may propagate.
+func request(fnl *funnel.Funnel, id string, opExeFunc func() (interface{}, error)) (res interface{}, opErr error, deliveryErr error, recovered interface{}) {
+	defer func() {
+		recovered = recover()
+	}()
+	res, opErr, deliveryErr = fnl.ExecuteDetailed(id, opExeFunc)
+	return
+}
+
+// withDefaults returns the configuration with the defaults of its zero fields.
+func (cfg StressConfig) withDefaults() StressConfig {
+	if cfg.Goroutines == 0 {
+		cfg.Goroutines = 8
+	}
+	if cfg.Requests == 0 {
+		cfg.Requests = 1000
+	}
+	if cfg.Ids == 0 {
+		cfg.Ids = 16
+	}
+	if cfg.ExecDelay == 0 {
+		cfg.ExecDelay = time.Millisecond
+	}
+	return cfg
+}
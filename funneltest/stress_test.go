@@ -0,0 +1,52 @@
+package funneltest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/intuit/funnel"
+)
+
+func TestStress(t *testing.T) {
+	fnl := funnel.New(funnel.WithTimeout(time.Millisecond*5), funnel.WithCacheTtl(time.Millisecond))
+
+	report, err := Stress(fnl, StressConfig{
+		Goroutines: 16,
+		Requests:   300,
+		PanicRate:  0.05,
+		ErrorRate:  0.1,
+		ForgetRate: 0.05,
+		SlowRate:   0.02,
+		SlowDelay:  time.Millisecond * 10,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if report.Requests+report.Forgets != 16*300 {
+		t.Error("Expected every request to be made, got ", report)
+	}
+	if report.Executions == 0 || report.Executions >= report.Requests {
+		t.Error("Expected the requests to be coalesced, got ", report)
+	}
+	if report.Undelivered == 0 {
+		t.Error("Expected the slow executions to time out, got ", report)
+	}
+}
+
+func TestStressServeStaleOnPanic(t *testing.T) {
+	fnl := funnel.New(funnel.WithTimeout(time.Millisecond*5), funnel.WithServeStaleOnPanic(true), funnel.WithConcurrencyBudget(4))
+
+	_, err := Stress(fnl, StressConfig{Requests: 200, PanicRate: 0.2, ForgetRate: 0.05})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func ExampleStress() {
+	fnl := funnel.New(funnel.WithTimeout(time.Millisecond*5), funnel.WithCacheTtl(time.Millisecond))
+
+	_, err := Stress(fnl, StressConfig{PanicRate: 0.01, SlowRate: 0.01, SlowDelay: time.Millisecond * 10})
+	fmt.Println(err)
+	// Output: <nil>
+}
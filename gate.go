@@ -0,0 +1,74 @@
+package funnel
+
+import "sync"
+
+// costGate limits the sum of the costs of operations that execute concurrently.
+// Waiters are admitted in FIFO order, so a heavy operation is not starved by a stream of lighter ones.
+type costGate struct {
+	sync.Mutex
+
+	// The total budget shared by all the executing operations.
+	total int
+
+	// The sum of the costs of operations currently admitted.
+	inUse int
+
+	// Operations waiting for admission, in arrival order.
+	waiters []*gateWaiter
+}
+
+type gateWaiter struct {
+	cost  int
+	ready chan empty
+}
+
+func newCostGate(total int) *costGate {
+	return &costGate{total: total}
+}
+
+// acquire blocks until the given cost can be admitted within the budget and returns the cost that was actually taken.
+// A cost larger than the whole budget is clamped to the budget, so such an operation runs alone instead of never.
+// A cost of zero or less is admitted immediately.
+func (g *costGate) acquire(cost int) int {
+	if cost <= 0 {
+		return 0
+	}
+	if cost > g.total {
+		cost = g.total
+	}
+
+	g.Lock()
+	if len(g.waiters) == 0 && g.inUse+cost <= g.total {
+		g.inUse += cost
+		g.Unlock()
+		return cost
+	}
+	w := &gateWaiter{cost: cost, ready: make(chan empty)}
+	g.waiters = append(g.waiters, w)
+	g.Unlock()
+
+	<-w.ready
+	return cost
+}
+
+// release returns the given cost to the budget and admits as many waiting operations as now fit.
+func (g *costGate) release(cost int) {
+	if cost <= 0 {
+		return
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	g.inUse -= cost
+	for len(g.waiters) > 0 {
+		w := g.waiters[0]
+		if g.inUse+w.cost > g.total {
+			break
+		}
+		g.inUse += w.cost
+		g.waiters[0] = nil
+		g.waiters = g.waiters[1:]
+		close(w.ready)
+	}
+}
@@ -0,0 +1,202 @@
+package funnel
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Operations with a cost of 2 under a budget of 3 must run one at a time although a count-based limit of 3 would let them all run.
+func TestConcurrencyBudget(t *testing.T) {
+	fnl := New(WithConcurrencyBudget(3))
+
+	var inFlightCost, maxInFlightCost int64
+	execute := func(cost int) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			cur := atomic.AddInt64(&inFlightCost, int64(cost))
+			for {
+				max := atomic.LoadInt64(&maxInFlightCost)
+				if cur <= max || atomic.CompareAndSwapInt64(&maxInFlightCost, max, cur) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 50)
+			atomic.AddInt64(&inFlightCost, -int64(cost))
+			return nil, nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	numOfOperations := 4
+	wg.Add(numOfOperations)
+	start := time.Now()
+	for i := 0; i < numOfOperations; i++ {
+		go func(id string) {
+			defer wg.Done()
+			fnl.ExecuteWithCost(id, 2, execute(2))
+		}("heavy" + strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	if maxCost := atomic.LoadInt64(&maxInFlightCost); maxCost != 2 {
+		t.Error("Expected heavy operations to execute one at a time, max in flight cost ", maxCost)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*50*time.Duration(numOfOperations) {
+		t.Error("Expected heavy operations to be serialized by the budget, elapsed ", elapsed)
+	}
+
+	// Light operations fit together within the same budget.
+	atomic.StoreInt64(&maxInFlightCost, 0)
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		go func(id string) {
+			defer wg.Done()
+			fnl.Execute(id, execute(1))
+		}("light" + strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	if maxCost := atomic.LoadInt64(&maxInFlightCost); maxCost != 3 {
+		t.Error("Expected light operations to execute concurrently, max in flight cost ", maxCost)
+	}
+}
+
+// A cost exceeding the whole budget is admitted once nothing else executes rather than blocking forever.
+func TestConcurrencyBudgetCostAboveBudget(t *testing.T) {
+	fnl := New(WithConcurrencyBudget(2), WithTimeout(time.Second))
+
+	res, err := fnl.ExecuteWithCost("huge", 5, func() (interface{}, error) {
+		return "done", nil
+	})
+	if res != "done" || err != nil {
+		t.Error("Expected operation with a cost above the budget to execute, got ", res, err)
+	}
+}
+
+func TestConcurrencyBudgetReleasedOnPanic(t *testing.T) {
+	fnl := New(WithConcurrencyBudget(1), WithTimeout(time.Second))
+
+	func() {
+		defer func() { recover() }()
+		fnl.Execute("panics", func() (interface{}, error) {
+			panic("test ends with panic")
+		})
+	}()
+
+	res, err := fnl.Execute("after", func() (interface{}, error) {
+		return "done", nil
+	})
+	if res != "done" || err != nil {
+		t.Error("Expected the budget to be released by the panicking operation, got ", res, err)
+	}
+}
+
+func TestConcurrencyBudgetSkipsAbandonedExecution(t *testing.T) {
+	fnl := New(WithConcurrencyBudget(1), WithTimeout(time.Millisecond*50))
+
+	release := make(chan empty)
+	go fnl.Execute("blocker", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	time.Sleep(time.Millisecond * 10)
+
+	var numOfExecutions uint64
+	_, err := fnl.Execute("starved", func() (interface{}, error) {
+		atomic.AddUint64(&numOfExecutions, 1)
+		return nil, nil
+	})
+	if err != timeoutError {
+		t.Fatal("Expected the operation waiting for the budget to time out, got ", err)
+	}
+
+	close(release)
+	time.Sleep(time.Millisecond * 50)
+	if n := atomic.LoadUint64(&numOfExecutions); n != 0 {
+		t.Error("Expected the abandoned operation not to be executed, executed ", n, " times")
+	}
+
+	// The budget is available again for new operations.
+	res, err := fnl.Execute("after", func() (interface{}, error) {
+		return "done", nil
+	})
+	if res != "done" || err != nil {
+		t.Error("Expected the budget to be released by the abandoned operation, got ", res, err)
+	}
+}
+
+// Requests coalesced with an operation executing within the budget don't wait for the budget, unlike a distinct
+// operation, which times out waiting for it.
+func TestConcurrencyBudgetCoalescedRequests(t *testing.T) {
+	fnl := New(WithConcurrencyBudget(1))
+
+	release := make(chan empty)
+	var wg sync.WaitGroup
+	numOfRequests := 5
+	wg.Add(numOfRequests)
+	var numOfExecutions int32
+	for i := 0; i < numOfRequests; i++ {
+		go func() {
+			defer wg.Done()
+			res, err := fnl.Execute("running", func() (interface{}, error) {
+				atomic.AddInt32(&numOfExecutions, 1)
+				<-release
+				return "res", nil
+			})
+			if res != "res" || err != nil {
+				t.Error("Expected coalesced requests to receive the result, got ", res, err)
+			}
+		}()
+	}
+
+	for fnl.Dump().Waiters < numOfRequests {
+		time.Sleep(time.Millisecond)
+	}
+
+	var distinctExecuted int32
+	_, err := fnl.Execute("distinct", func() (interface{}, error) {
+		atomic.StoreInt32(&distinctExecuted, 1)
+		return nil, nil
+	}, WithCallTimeout(time.Millisecond*50))
+	if err != timeoutError || atomic.LoadInt32(&distinctExecuted) != 0 {
+		t.Error("Expected the distinct operation to time out waiting for the budget, got ", err)
+	}
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&numOfExecutions); n != 1 {
+		t.Error("Expected a single execution of the coalesced requests, got ", n)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	fnl := New(WithMaxConcurrency(2))
+
+	var inFlight, maxInFlight int64
+	var wg sync.WaitGroup
+	numOfOperations := 6
+	wg.Add(numOfOperations)
+	for i := 0; i < numOfOperations; i++ {
+		go func(id string) {
+			defer wg.Done()
+			fnl.Execute(id, func() (interface{}, error) {
+				cur := atomic.AddInt64(&inFlight, 1)
+				for {
+					max := atomic.LoadInt64(&maxInFlight)
+					if cur <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, cur) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond * 20)
+				atomic.AddInt64(&inFlight, -1)
+				return nil, nil
+			})
+		}("op" + strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	if max := atomic.LoadInt64(&maxInFlight); max != 2 {
+		t.Error("Expected at most 2 operations to execute at once, max in flight ", max)
+	}
+}
@@ -0,0 +1,75 @@
+package funnel
+
+import "context"
+
+// groupKey identifies a group of operations: the operations tagged with the same group identifier and started under the
+// same context.
+type groupKey struct {
+	groupId string
+	ctx     context.Context
+}
+
+// opGroup holds the operations of a group that are in process. A group exists for as long as it has operations in
+// process, and its context is watched meanwhile.
+type opGroup struct {
+	key groupKey
+	ops map[*operationInProcess]empty
+
+	// stop is closed once the group has no more operation in process, to stop watching its context.
+	stop chan empty
+}
+
+// ExecuteContextGroup is like ExecuteContext, but if the request starts the operation, the operation is tagged with the
+// group, so that once ctx is done all the operations of the group that are still in process are canceled (see Cancel)
+// with the cause of the context as the reason, rather than only this request giving up. A group is made of the
+// operations started with the same group identifier under the same context, modeling the sub-operations of a request
+// canceled together. An operation that was started by another request is joined as usual and not tagged.
+func (f *Funnel) ExecuteContextGroup(ctx context.Context, groupId string, operationId string, opExeFunc func(ctx context.Context) (interface{}, error)) (res interface{}, err error) {
+	return f.executeContext(ctx, callConfig{cost: 1, group: &groupKey{groupId: groupId, ctx: ctx}}, operationId, opExeFunc)
+}
+
+// joinGroup adds the operation to the group, watching the group's context if it's the group's first operation in
+// process. Must be called with the lock held.
+func (f *Funnel) joinGroup(op *operationInProcess, key groupKey) {
+	group, found := f.groups[key]
+	if !found {
+		group = &opGroup{key: key, ops: make(map[*operationInProcess]empty), stop: make(chan empty)}
+		f.groups[key] = group
+		go f.watchGroup(group)
+	}
+	group.ops[op] = empty{}
+	op.group = group
+}
+
+// leaveGroup removes the operation from its group, if any, once it's no more in process. The group is dropped with its
+// last operation. Must be called with the lock held.
+func (f *Funnel) leaveGroup(op *operationInProcess) {
+	group := op.group
+	if group == nil {
+		return
+	}
+	op.group = nil
+
+	delete(group.ops, op)
+	if len(group.ops) == 0 {
+		delete(f.groups, group.key)
+		close(group.stop)
+	}
+}
+
+// watchGroup cancels the operations in process of the group once its context is done.
+func (f *Funnel) watchGroup(group *opGroup) {
+	select {
+	case <-group.stop:
+	case <-group.key.ctx.Done():
+		reason := context.Cause(group.key.ctx)
+
+		f.Lock()
+		defer f.Unlock()
+
+		// The completed operations are not canceled, they leave the group once closed.
+		for op := range group.ops {
+			f.cancel(op, reason)
+		}
+	}
+}
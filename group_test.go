@@ -0,0 +1,88 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteContextGroup(t *testing.T) {
+	fnl := New()
+	untilCanceled := func(execCtx context.Context) (interface{}, error) {
+		<-execCtx.Done()
+		return nil, context.Cause(execCtx)
+	}
+
+	parent, cancel := context.WithCancelCause(context.Background())
+	other, cancelOther := context.WithCancel(context.Background())
+	defer cancelOther()
+
+	numOfOperations := 3
+	var wg sync.WaitGroup
+	wg.Add(numOfOperations)
+	errs := make(chan error, numOfOperations)
+	for i := 0; i < numOfOperations; i++ {
+		go func(id string) {
+			defer wg.Done()
+			_, err := fnl.ExecuteContextGroup(parent, "request", id, func(execCtx context.Context) (interface{}, error) {
+				return untilCanceled(execCtx)
+			})
+			errs <- err
+		}(strconv.Itoa(i))
+	}
+
+	// The same group identifier under another context is another group.
+	otherDone := make(chan empty)
+	go func() {
+		defer close(otherDone)
+		fnl.ExecuteContextGroup(other, "request", "other", untilCanceled)
+	}()
+
+	assert.Eventually(t, func() bool { return fnl.Dump().Operations == numOfOperations+1 }, time.Second, time.Millisecond)
+	fnl.Lock()
+	assert.Len(t, fnl.groups, 2)
+	fnl.Unlock()
+
+	reason := errors.New("client disconnected")
+	cancel(reason)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.True(t, errors.Is(err, ErrCanceled))
+		assert.True(t, errors.Is(err, reason))
+	}
+	assert.Eventually(t, func() bool { return fnl.Dump().Operations == 1 }, time.Second, time.Millisecond)
+	assert.True(t, fnl.IsOpInProgress("other"))
+
+	// The request gives up on its context while the group's operations are canceled concurrently.
+	cancelOther()
+	<-otherDone
+	assert.Eventually(t, func() bool {
+		fnl.Lock()
+		defer fnl.Unlock()
+		return len(fnl.groups) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestExecuteContextGroupReleasedOnCompletion(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	res, err := fnl.ExecuteContextGroup(ctx, "request", "opId", func(context.Context) (interface{}, error) {
+		return "res", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "res", res)
+	fnl.Lock()
+	assert.Len(t, fnl.groups, 0)
+	fnl.Unlock()
+
+	// A completed operation is not canceled with its group.
+	cancel()
+	assert.True(t, fnl.IsOpInProgress("opId"))
+}
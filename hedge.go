@@ -0,0 +1,40 @@
+package funnel
+
+import "time"
+
+// runHedged executes the operation, starting an additional concurrent execution every hedge delay, up to the configured
+// maximum, for as long as none of the executions returned (see WithHedging). It returns the outcome of the first
+// execution to return, which may be a panic; the outcomes of the other executions are discarded.
+func (f *Funnel) runHedged(op *operationInProcess, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
+	// Buffered for all the executions, so that the discarded ones don't block once the first one returned.
+	outcomes := make(chan opResult, op.config.maxHedges+1)
+	run := func() {
+		var out opResult
+		defer func() {
+			out.panicErr = recover()
+			outcomes <- out
+		}()
+		out.res, out.err = opExeFunc()
+	}
+
+	go run()
+	for hedges := 0; ; hedges++ {
+		var hedge <-chan time.Time
+		// No further execution is started once the operation was deleted, since nobody would receive its result.
+		if hedges < op.config.maxHedges && !op.deleted.IsSet() {
+			timer := time.NewTimer(op.config.hedgeDelay)
+			defer timer.Stop()
+			hedge = timer.C
+		}
+
+		select {
+		case out := <-outcomes:
+			if out.panicErr != nil {
+				panic(out.panicErr)
+			}
+			return out.res, out.err
+		case <-hedge:
+			go run()
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package funnel
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedgingSlowThenFast(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithHedging(time.Millisecond*10, 1))
+
+	var numOfExecutions int32
+	release := make(chan empty)
+	defer close(release)
+	opExeFunc := func() (interface{}, error) {
+		if atomic.AddInt32(&numOfExecutions, 1) == 1 {
+			<-release // The first execution is stuck, the hedge returns right away.
+			return "slow", nil
+		}
+		return "fast", nil
+	}
+
+	start := time.Now()
+	res, err := fnl.Execute("opId", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, "fast", res)
+	assert.True(t, time.Since(start) < time.Second, "hedged execution should not wait for the slow one")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&numOfExecutions))
+
+	// Only the first result is cached.
+	res, err = fnl.Execute("opId", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, "fast", res)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&numOfExecutions))
+}
+
+func TestHedgingMaxHedges(t *testing.T) {
+	maxHedges := 2
+	fnl := New(WithHedging(time.Millisecond, maxHedges))
+
+	var numOfExecutions int32
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		n := atomic.AddInt32(&numOfExecutions, 1)
+		time.Sleep(time.Millisecond * 30)
+		return n, nil
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, res)
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, int32(maxHedges+1), atomic.LoadInt32(&numOfExecutions))
+}
+
+func TestHedgingNotWhenFast(t *testing.T) {
+	fnl := New(WithHedging(time.Millisecond*50, 3))
+
+	var numOfExecutions int32
+	fnl.Execute("opId", func() (interface{}, error) {
+		atomic.AddInt32(&numOfExecutions, 1)
+		return nil, nil
+	})
+	time.Sleep(time.Millisecond * 60)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&numOfExecutions))
+}
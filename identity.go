@@ -0,0 +1,29 @@
+package funnel
+
+import "fmt"
+
+// defaultIdentity derives the operation's identifier from arguments that are a string or a fmt.Stringer.
+// Any other arguments are not coalesced.
+func defaultIdentity(args interface{}) (string, bool) {
+	switch a := args.(type) {
+	case string:
+		return a, true
+	case fmt.Stringer:
+		return a.String(), true
+	}
+	return "", false
+}
+
+// ExecuteIdentity is like Execute, but the operation's identifier is derived from the operation's arguments with the
+// identity function (see WithIdentityFunc), and the arguments are passed to the operation's function.
+// When the identity function reports that the arguments have no identity, the operation is not coalesced: the function
+// is executed directly on the calling goroutine, and its result is neither shared nor cached.
+func (f *Funnel) ExecuteIdentity(args interface{}, opExeFunc func(args interface{}) (interface{}, error)) (res interface{}, err error) {
+	operationId, ok := f.currentConfig().identity(args)
+	if !ok {
+		return opExeFunc(args)
+	}
+	return f.Execute(operationId, func() (interface{}, error) {
+		return opExeFunc(args)
+	})
+}
@@ -0,0 +1,71 @@
+package funnel
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type query struct {
+	table   string
+	id      int
+	noCache bool
+}
+
+func TestExecuteIdentity(t *testing.T) {
+	fnl := New(WithIdentityFunc(func(args interface{}) (string, bool) {
+		q := args.(query)
+		if q.noCache {
+			return "", false
+		}
+		return q.table + "/" + strconv.Itoa(q.id), true
+	}))
+
+	var numOfExecutions uint64
+	operation := func(args interface{}) (interface{}, error) {
+		atomic.AddUint64(&numOfExecutions, 1)
+		time.Sleep(time.Millisecond * 50)
+		return args.(query).id, nil
+	}
+
+	var wg sync.WaitGroup
+	numOfGoroutines := 10
+	wg.Add(numOfGoroutines * 2)
+	for i := 0; i < numOfGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			res, _ := fnl.ExecuteIdentity(query{table: "users", id: 7}, operation)
+			assert.Equal(t, 7, res)
+		}()
+		go func() {
+			defer wg.Done()
+			res, _ := fnl.ExecuteIdentity(query{table: "users", id: 8, noCache: true}, operation)
+			assert.Equal(t, 8, res)
+		}()
+	}
+	wg.Wait()
+
+	// One coalesced execution, and one standalone execution per uncoalesced request.
+	assert.Equal(t, uint64(1+numOfGoroutines), atomic.LoadUint64(&numOfExecutions))
+}
+
+func TestExecuteIdentityDefault(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	var numOfExecutions uint64
+	operation := func(args interface{}) (interface{}, error) {
+		atomic.AddUint64(&numOfExecutions, 1)
+		return args, nil
+	}
+
+	fnl.ExecuteIdentity("key", operation)
+	fnl.ExecuteIdentity("key", operation)
+	fnl.ExecuteIdentity(42, operation)
+	fnl.ExecuteIdentity(42, operation)
+
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&numOfExecutions))
+}
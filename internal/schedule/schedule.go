@@ -0,0 +1,29 @@
+// Package schedule defines the hook that lets package funneltest interpose at key points of an operation's lifecycle,
+// without making the hook part of the public API of package funnel.
+package schedule
+
+// Point identifies a point in an operation's lifecycle at which the installed Scheduler is consulted.
+type Point int
+
+const (
+	// BeforeExecute is reached by the execution goroutine right before the operation's function is invoked.
+	BeforeExecute Point = iota
+
+	// BeforeClose is reached once the operation's function returned (or panicked), before its result is published.
+	BeforeClose
+
+	// BeforeDelete is reached before a single operation is deleted from the funnel because it timed out or its cache
+	// time-to-live expired. It is not reached when a result that should not be cached is dropped
+	// as the operation completes, nor by Forget and ForgetIf, which delete operations atomically under the funnel's lock.
+	BeforeDelete
+)
+
+// A Scheduler is consulted at the points of each operation's lifecycle. Reach is called without holding the funnel's
+// lock and may block to delay the operation.
+type Scheduler interface {
+	Reach(point Point, operationId string)
+}
+
+// WithScheduler returns a funnel.Option installing the given Scheduler. It is set by package funnel when it's
+// initialized, and is typed interface{} since this package can't import package funnel.
+var WithScheduler func(s Scheduler) interface{}
@@ -0,0 +1,22 @@
+package funnel
+
+// key returns the identity of the operation with the given identifier, as derived by the key extractor (see WithKeyExtractor).
+func (f *Funnel) key(operationId string) string {
+	extractKey := f.currentConfig().extractKey
+	if extractKey == nil {
+		return operationId
+	}
+	return extractKey(operationId)
+}
+
+// keys returns a new slice with the identities of the operations with the given identifiers.
+func (f *Funnel) keys(operationIds []string) []string {
+	if operationIds == nil {
+		return nil
+	}
+	keys := make([]string, len(operationIds))
+	for i, id := range operationIds {
+		keys[i] = f.key(id)
+	}
+	return keys
+}
@@ -0,0 +1,50 @@
+package funnel
+
+import (
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dropVolatileParams extracts the identity of an URL without its volatile query parameters.
+func dropVolatileParams(rawKey string) string {
+	u, err := url.Parse(rawKey)
+	if err != nil {
+		return rawKey
+	}
+	q := u.Query()
+	q.Del("ts")
+	q.Del("requestId")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestWithKeyExtractor(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithKeyExtractor(dropVolatileParams))
+
+	var numOfExecutions int32
+	opExeFunc := func() (interface{}, error) {
+		return atomic.AddInt32(&numOfExecutions, 1), nil
+	}
+
+	res, err := fnl.Execute("http://api/users?id=7&ts=1000&requestId=a", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), res)
+
+	// Differs only in the volatile parameters, coalesced with the first.
+	res, err = fnl.Execute("http://api/users?requestId=b&id=7&ts=2000", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), res)
+	assert.True(t, fnl.IsOpInProgress("http://api/users?id=7&ts=3000"))
+
+	// A different stable parameter is a different operation.
+	res, err = fnl.Execute("http://api/users?id=8&ts=1000", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), res)
+
+	fnl.Forget("http://api/users?id=7&ts=4000")
+	assert.False(t, fnl.IsOpInProgress("http://api/users?id=7"))
+}
@@ -0,0 +1,185 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNoLoader is returned by GetOrLoad and GetOrLoadAll when the funnel has no loader (see WithLoader and WithBatchLoader).
+var ErrNoLoader = errors.New("No loader is configured for the funnel")
+
+// ErrNotLoaded is the error of a key that the batch loader didn't return a value for.
+var ErrNotLoaded = errors.New("Batch loader returned no value for the key")
+
+// A Loader loads the value of a key, for funnels used as a read-through cache (see WithLoader and GetOrLoad).
+type Loader interface {
+	Load(key string) (interface{}, error)
+}
+
+// LoaderFunc adapts an ordinary function to the Loader interface.
+type LoaderFunc func(key string) (interface{}, error)
+
+// Load calls the function.
+func (fn LoaderFunc) Load(key string) (interface{}, error) {
+	return fn(key)
+}
+
+// GetOrLoad returns the value of the key, loaded by the funnel's loader (see WithLoader). It is like Execute with the
+// key as the operation's identifier and the loader as the operation's function: concurrent requests for the same key
+// are coalesced into a single load, and the value is cached for the cache time-to-live.
+// Returns ErrNoLoader when the funnel has no loader.
+func (f *Funnel) GetOrLoad(key string) (interface{}, error) {
+	loader := f.currentConfig().loader
+	if loader == nil {
+		return nil, ErrNoLoader
+	}
+	return f.Execute(key, func() (interface{}, error) {
+		return loader.Load(key)
+	})
+}
+
+// A BatchLoader loads the values of several keys at once, see WithBatchLoader and GetOrLoadAll.
+// The returned map may lack some of the keys, whose values were not found.
+type BatchLoader interface {
+	LoadAll(keys []string) (map[string]interface{}, error)
+}
+
+// BatchLoaderFunc adapts an ordinary function to the BatchLoader interface.
+type BatchLoaderFunc func(keys []string) (map[string]interface{}, error)
+
+// LoadAll calls the function.
+func (fn BatchLoaderFunc) LoadAll(keys []string) (map[string]interface{}, error) {
+	return fn(keys)
+}
+
+// BatchError is returned by GetOrLoadAll when some of the keys could not be served, with the error of each of them.
+type BatchError struct {
+	Errs map[string]error
+}
+
+// Error lists the keys that could not be served along with their errors.
+func (e *BatchError) Error() string {
+	keys := make([]string, 0, len(e.Errs))
+	for key := range e.Errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, len(keys))
+	for i, key := range keys {
+		msgs[i] = fmt.Sprintf("%s: %v", key, e.Errs[key])
+	}
+	return "failed to get " + strings.Join(msgs, ", ")
+}
+
+// Unwrap returns the errors of the keys, so that errors.Is and errors.As match any of them.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// batchLoad is the outcome of a single LoadAll call shared by the operations of its keys.
+type batchLoad struct {
+	done chan empty
+	opResult
+	values map[string]interface{}
+}
+
+// result returns the key's outcome of the batch load, once done.
+func (b *batchLoad) result(key string) (interface{}, error) {
+	<-b.done
+	if b.panicErr != nil {
+		panic(b.panicErr)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	value, found := b.values[key]
+	if !found {
+		return nil, ErrNotLoaded
+	}
+	return value, nil
+}
+
+// GetOrLoadAll returns the values of the keys, like GetOrLoad but with the funnel's batch loader (see WithBatchLoader):
+// the keys that are cached or being loaded are served like GetOrLoad would, and all the others are loaded by a single
+// LoadAll call. Each key is an operation of its own, so the values are cached, and coalesced with concurrent requests,
+// key by key.
+// The returned map holds the values of the keys that were served without error. If any key failed, a *BatchError with
+// the error of each failed key is returned as well: the error returned by LoadAll, ErrNotLoaded for a key missing from
+// its result, or the error a key would get from GetOrLoad (e.g. the timeout). If LoadAll panics, GetOrLoadAll panics the
+// same way. Returns ErrNoLoader when the funnel has no batch loader.
+func (f *Funnel) GetOrLoadAll(keys []string) (map[string]interface{}, error) {
+	loader := f.currentConfig().batchLoader
+	if loader == nil {
+		return nil, ErrNoLoader
+	}
+
+	batch := &batchLoad{done: make(chan empty)}
+	var missing []string
+	ops := make(map[string]*operationInProcess, len(keys))
+	errs := make(map[string]error)
+	for _, key := range keys {
+		if _, found := ops[key]; found {
+			continue
+		}
+
+		// The operations started here are not charged to the concurrency budget, the batch load is.
+		key := key
+		op, started, err := f.startOperation(key, callConfig{cost: 0, awaits: true}, func() (interface{}, error) {
+			return batch.result(key)
+		})
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		ops[key] = op
+		if started {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		go f.loadBatch(loader, missing, batch)
+	} else {
+		close(batch.done)
+	}
+
+	values := make(map[string]interface{}, len(ops))
+	for key, op := range ops {
+		res, opErr, deliveryErr := f.await(context.Background(), op, op.config.timeout, true)
+		if deliveryErr == timeoutError {
+			f.deleteTimedOut(op)
+		}
+		if deliveryErr != nil {
+			errs[key] = deliveryErr
+		} else if opErr != nil {
+			errs[key] = opErr
+		} else {
+			values[key] = res
+		}
+	}
+
+	if len(errs) > 0 {
+		return values, &BatchError{Errs: errs}
+	}
+	return values, nil
+}
+
+// loadBatch loads the keys with the batch loader, and releases the operations of the keys with the outcome.
+func (f *Funnel) loadBatch(loader BatchLoader, keys []string, batch *batchLoad) {
+	defer close(batch.done)
+	defer func() {
+		batch.panicErr = recover()
+	}()
+	if f.gate != nil {
+		defer f.gate.release(f.gate.acquire(1))
+	}
+	batch.values, batch.err = loader.LoadAll(keys)
+}
@@ -0,0 +1,96 @@
+package funnel
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	var numOfLoads int32
+	loader := LoaderFunc(func(key string) (interface{}, error) {
+		atomic.AddInt32(&numOfLoads, 1)
+		time.Sleep(time.Millisecond * 10)
+		return "value of " + key, nil
+	})
+	cacheTtl := time.Millisecond * 100
+	fnl := New(WithCacheTtl(cacheTtl), WithLoader(loader))
+
+	numOfKeys, numOfGoroutines := 3, 20
+	var wg sync.WaitGroup
+	wg.Add(numOfKeys * numOfGoroutines)
+	for i := 0; i < numOfKeys*numOfGoroutines; i++ {
+		go func(key string) {
+			defer wg.Done()
+			res, err := fnl.GetOrLoad(key)
+			assert.Nil(t, err)
+			assert.Equal(t, "value of "+key, res)
+		}(strconv.Itoa(i % numOfKeys))
+	}
+	wg.Wait()
+	assert.Equal(t, int32(numOfKeys), atomic.LoadInt32(&numOfLoads))
+
+	// Loaded again once the time-to-live expired.
+	time.Sleep(cacheTtl)
+	fnl.GetOrLoad("0")
+	assert.Equal(t, int32(numOfKeys+1), atomic.LoadInt32(&numOfLoads))
+}
+
+func TestGetOrLoadNoLoader(t *testing.T) {
+	_, err := New().GetOrLoad("key")
+	assert.Equal(t, ErrNoLoader, err)
+}
+
+func TestGetOrLoadAll(t *testing.T) {
+	var batches [][]string
+	var mu sync.Mutex
+	loadErr := errors.New("load error")
+	loader := BatchLoaderFunc(func(keys []string) (map[string]interface{}, error) {
+		mu.Lock()
+		batches = append(batches, append([]string(nil), keys...))
+		mu.Unlock()
+		if keys[0] == "failing" {
+			return nil, loadErr
+		}
+		values := make(map[string]interface{})
+		for _, key := range keys {
+			if key != "unknown" {
+				values[key] = "value of " + key
+			}
+		}
+		return values, nil
+	})
+	fnl := New(WithCacheTtl(time.Hour), WithBatchLoader(loader))
+
+	values, err := fnl.GetOrLoadAll([]string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": "value of a", "b": "value of b"}, values)
+
+	// Only the uncached keys are loaded, in a single call.
+	values, err = fnl.GetOrLoadAll([]string{"a", "c", "b", "d", "unknown", "c"})
+	assert.Equal(t, map[string]interface{}{
+		"a": "value of a", "b": "value of b", "c": "value of c", "d": "value of d",
+	}, values)
+	var batchErr *BatchError
+	if assert.True(t, errors.As(err, &batchErr)) {
+		assert.Equal(t, map[string]error{"unknown": ErrNotLoaded}, batchErr.Errs)
+	}
+	assert.True(t, errors.Is(err, ErrNotLoaded))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c", "d", "unknown"}}, batches)
+
+	_, err = fnl.GetOrLoadAll([]string{"failing", "a"})
+	if assert.True(t, errors.As(err, &batchErr)) {
+		assert.Equal(t, map[string]error{"failing": loadErr}, batchErr.Errs)
+	}
+	assert.Len(t, batches, 3)
+}
+
+func TestGetOrLoadAllNoLoader(t *testing.T) {
+	_, err := New().GetOrLoadAll([]string{"key"})
+	assert.Equal(t, ErrNoLoader, err)
+}
@@ -0,0 +1,63 @@
+package funnel
+
+// LookupStatus describes the state of an operation in the funnel, as returned by Lookup.
+type LookupStatus int
+
+const (
+	// StatusMiss means the funnel holds neither a result nor an execution in process for the operation.
+	StatusMiss LookupStatus = iota
+
+	// StatusInFlight means the operation is being executed and its result is not available yet.
+	StatusInFlight
+
+	// StatusCached means the operation's result is available in the funnel.
+	StatusCached
+)
+
+// String returns the name of the status.
+func (s LookupStatus) String() string {
+	switch s {
+	case StatusMiss:
+		return "Miss"
+	case StatusInFlight:
+		return "InFlight"
+	case StatusCached:
+		return "Cached"
+	}
+	return "Unknown"
+}
+
+// Lookup returns the state of the operation in the funnel without executing or waiting for it. The result and error
+// of the operation are returned only when the status is StatusCached. An operation that ended with a panic is
+// reported as StatusMiss, since there is no result to return.
+func (f *Funnel) Lookup(operationId string) (res interface{}, err error, status LookupStatus) {
+	operationId = f.key(operationId)
+
+	f.Lock()
+	op, found := f.findOperation(operationId)
+	f.Unlock()
+
+	if !found {
+		return nil, nil, StatusMiss
+	}
+	if op.completed.IsSet() {
+		if op.cacheable {
+			return op.res, op.err, StatusCached
+		}
+		// The result is being delivered to the waiting goroutines and will be deleted right away.
+		return nil, nil, StatusInFlight
+	}
+
+	if !op.inProcess() { // The operation ended with panic.
+		return nil, nil, StatusMiss
+	}
+	return nil, nil, StatusInFlight
+}
+
+// TryExecute returns the cached result of the operation without blocking, e.g. for computing a fallback rather than
+// waiting: ok is true only when the result is cached (StatusCached, see Lookup). It never starts an execution, nor
+// waits for one in process.
+func (f *Funnel) TryExecute(operationId string) (res interface{}, err error, ok bool) {
+	res, err, status := f.Lookup(operationId)
+	return res, err, status == StatusCached
+}
@@ -0,0 +1,122 @@
+package funnel
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intuit/funnel/internal/schedule"
+	"github.com/stretchr/testify/assert"
+)
+
+// pointGate is a scheduler blocking the first operation that reaches point until release is closed.
+type pointGate struct {
+	point   schedule.Point
+	reached chan empty
+	release chan empty
+	once    sync.Once
+}
+
+func newPointGate(point schedule.Point) *pointGate {
+	return &pointGate{point: point, reached: make(chan empty), release: make(chan empty)}
+}
+
+func (g *pointGate) Reach(point schedule.Point, operationId string) {
+	if point == g.point {
+		g.once.Do(func() {
+			close(g.reached)
+			<-g.release
+		})
+	}
+}
+
+func (g *pointGate) option() Option {
+	return func(cfg *Config) {
+		cfg.scheduler = g
+	}
+}
+
+func TestLookup(t *testing.T) {
+	gate := newPointGate(schedule.BeforeExecute)
+	fnl := New(WithCacheTtl(time.Hour), gate.option())
+
+	res, err, status := fnl.Lookup("opId")
+	assert.Equal(t, StatusMiss, status)
+	assert.Nil(t, res)
+	assert.Nil(t, err)
+
+	done := make(chan empty)
+	opErr := errors.New("operation error")
+	go func() {
+		defer close(done)
+		fnl.Execute("opId", func() (interface{}, error) {
+			return "result", opErr
+		})
+	}()
+
+	<-gate.reached
+	_, _, status = fnl.Lookup("opId")
+	assert.Equal(t, StatusInFlight, status)
+
+	close(gate.release)
+	<-done
+
+	res, err, status = fnl.Lookup("opId")
+	assert.Equal(t, StatusCached, status)
+	assert.Equal(t, "result", res)
+	assert.Equal(t, opErr, err)
+}
+
+// A completed result that won't be cached must not be reported as cached while it's being delivered.
+func TestLookupNotCacheable(t *testing.T) {
+	gate := newPointGate(schedule.BeforeClose)
+	fnl := New(WithCacheTtl(time.Hour), gate.option(), WithShouldCachePredicate(func(interface{}, error) bool {
+		return false
+	}))
+
+	done := make(chan empty)
+	go func() {
+		defer close(done)
+		fnl.Execute("opId", func() (interface{}, error) {
+			return "result", nil
+		})
+	}()
+
+	<-gate.reached
+	_, _, status := fnl.Lookup("opId")
+	assert.Equal(t, StatusInFlight, status)
+
+	close(gate.release)
+	<-done
+	_, _, status = fnl.Lookup("opId")
+	assert.Equal(t, StatusMiss, status)
+}
+
+func TestLookupPanicked(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	func() {
+		defer func() { recover() }()
+		fnl.Execute("opId", func() (interface{}, error) {
+			panic("test ends with panic")
+		})
+	}()
+
+	_, _, status := fnl.Lookup("opId")
+	assert.Equal(t, StatusMiss, status)
+}
+
+func TestTryExecute(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	_, _, ok := fnl.TryExecute("opId")
+	assert.False(t, ok)
+	assert.False(t, fnl.IsOpInProgress("opId"), "no execution is started")
+
+	fnl.Execute("opId", func() (interface{}, error) { return "res", nil })
+	res, err, ok := fnl.TryExecute("opId")
+	assert.Equal(t, "res", res)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
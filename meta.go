@@ -0,0 +1,56 @@
+package funnel
+
+// Meta describes how the result of a request was produced, as returned by ExecuteMeta.
+type Meta struct {
+	// The generation of the delivered result, see Generation. It is 0 when the result was not cached.
+	Generation uint64
+
+	// Billable is true when the request started the execution whose result it received, i.e. caused an upstream call
+	// and should be charged for it, and false when the result was served from the cache or by joining an execution
+	// started by another request. Only the request that started an execution is billable for it.
+	Billable bool
+}
+
+// ExecuteMeta is like Execute, but also returns the metadata of the delivered result.
+func (f *Funnel) ExecuteMeta(operationId string, opExeFunc func() (interface{}, error)) (res interface{}, err error, meta Meta) {
+	op, started, res, opErr, deliveryErr := f.executeOperation(operationId, callConfig{cost: 1}, opExeFunc)
+	if deliveryErr != nil {
+		return nil, deliveryErr, meta
+	}
+
+	meta.Billable = started
+
+	f.Lock()
+	meta.Generation = op.generation
+	f.Unlock()
+	return res, opErr, meta
+}
+
+// ExecuteShared is like Execute, but also reports whether the result was shared: shared is false for the request that
+// started the execution whose result it received, and true for the requests that joined it while in process or were
+// served its cached result, like the shared result of golang.org/x/sync/singleflight. It is false as well when the
+// request could not be served an operation at all (e.g. ErrRateLimited).
+func (f *Funnel) ExecuteShared(operationId string, opExeFunc func() (interface{}, error)) (res interface{}, err error, shared bool) {
+	op, started, res, opErr, deliveryErr := f.executeOperation(operationId, callConfig{cost: 1}, opExeFunc)
+	shared = op != nil && !started
+	if deliveryErr != nil {
+		return nil, deliveryErr, shared
+	}
+	return res, opErr, shared
+}
+
+// Generation returns the generation of the operation's cached result, or 0 when no result is cached. Every cached result
+// gets a new generation, greater than the generations of all the results cached before it, so that a client polling the
+// operation can tell whether the result changed by comparing generations rather than results: a re-execution replacing
+// an expired or forgotten result increases the generation, while requests served from the cache don't.
+func (f *Funnel) Generation(operationId string) uint64 {
+	operationId = f.key(operationId)
+
+	f.Lock()
+	defer f.Unlock()
+
+	if op, found := f.findOperation(operationId); found {
+		return op.generation
+	}
+	return 0
+}
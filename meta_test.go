@@ -0,0 +1,111 @@
+package funnel
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneration(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	opExeFunc := func() (interface{}, error) { return "res", nil }
+
+	assert.Equal(t, uint64(0), fnl.Generation("opId"))
+	_, err, meta := fnl.ExecuteMeta("opId", opExeFunc)
+	assert.Nil(t, err)
+	first := fnl.Generation("opId")
+	assert.NotEqual(t, uint64(0), first)
+	assert.Equal(t, first, meta.Generation)
+
+	// Cache hits don't change the generation.
+	_, _, meta = fnl.ExecuteMeta("opId", opExeFunc)
+	assert.Equal(t, first, meta.Generation)
+	assert.Equal(t, first, fnl.Generation("opId"))
+
+	// Other operations have generations of their own.
+	fnl.Execute("other", opExeFunc)
+	assert.Equal(t, first, fnl.Generation("opId"))
+
+	// A re-execution bumps the generation.
+	fnl.Forget("opId")
+	assert.Equal(t, uint64(0), fnl.Generation("opId"))
+	_, _, meta = fnl.ExecuteMeta("opId", opExeFunc)
+	assert.True(t, meta.Generation > first)
+	assert.Equal(t, meta.Generation, fnl.Generation("opId"))
+
+	// A result that is not cached has no generation.
+	noCache := New(WithCacheTtl(time.Hour), WithShouldCachePredicate(func(interface{}, error) bool { return false }))
+	_, _, meta = noCache.ExecuteMeta("opId", opExeFunc)
+	assert.Equal(t, uint64(0), meta.Generation)
+}
+
+func TestMetaBillable(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	numOfRequests := 5
+	billable := make(chan bool, numOfRequests)
+	for i := 0; i < numOfRequests; i++ {
+		go func() {
+			_, err, meta := fnl.ExecuteMeta("opId", func() (interface{}, error) {
+				<-release
+				return "res", nil
+			})
+			assert.Nil(t, err)
+			billable <- meta.Billable
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&fnl.counters.waiters) == int64(numOfRequests)
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	numOfBillable := 0
+	for i := 0; i < numOfRequests; i++ {
+		if <-billable {
+			numOfBillable++
+		}
+	}
+	assert.Equal(t, 1, numOfBillable)
+
+	// Cache hits are free.
+	_, _, meta := fnl.ExecuteMeta("opId", nil)
+	assert.False(t, meta.Billable)
+}
+
+func TestExecuteShared(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	numOfRequests := 5
+	shared := make(chan bool, numOfRequests)
+	for i := 0; i < numOfRequests; i++ {
+		go func() {
+			res, err, isShared := fnl.ExecuteShared("opId", func() (interface{}, error) {
+				<-release
+				return "res", nil
+			})
+			assert.Equal(t, "res", res)
+			assert.Nil(t, err)
+			shared <- isShared
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&fnl.counters.waiters) == int64(numOfRequests)
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	numOfLeaders := 0
+	for i := 0; i < numOfRequests; i++ {
+		if !<-shared {
+			numOfLeaders++
+		}
+	}
+	assert.Equal(t, 1, numOfLeaders)
+
+	// A cached result is shared.
+	_, _, isShared := fnl.ExecuteShared("opId", nil)
+	assert.True(t, isShared)
+}
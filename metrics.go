@@ -0,0 +1,74 @@
+package funnel
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Metrics is notified of the outcome of the requests to the funnel and of the executions of its operations, e.g. for
+// maintaining counters of a metrics system that tell how effective the coalescing and the cache are (see WithMetrics).
+// The methods are called without holding the funnel's lock, on the goroutine of the request or of the execution, so
+// they must be safe for concurrent use and should return quickly.
+type Metrics interface {
+	// OnExecute is called for each request that started an execution of the operation.
+	OnExecute(operationId string)
+
+	// OnCoalesced is called for each request that joined an execution of the operation in process.
+	OnCoalesced(operationId string)
+
+	// OnCacheHit is called for each request that was served with the cached result of the operation.
+	OnCacheHit(operationId string)
+
+	// OnTimeout is called for each request that timed out waiting for the operation.
+	OnTimeout(operationId string)
+
+	// OnPanic is called for each execution of the operation that panicked.
+	OnPanic(operationId string)
+}
+
+// Logger is notified of the lifecycle of the operations for debugging, e.g. why a result was or wasn't cached (see
+// WithLogger): a request started an operation, joined it in process, was served with its cached result or timed out
+// waiting for it, and an execution completed, panicked or its cached result was evicted. Like the metrics, it's called
+// without holding the funnel's lock and must be safe for concurrent use.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+}
+
+// requested counts the outcome of a request for the operation, which either started an execution of the operation or
+// found the operation in the funnel, and notifies the metrics, the logger and the tracer, if any. The context of the
+// request may be nil.
+func (f *Funnel) requested(ctx context.Context, cfg *Config, operationId string, op *operationInProcess, started bool) {
+	m, logger := cfg.metrics, cfg.logger
+	if tracer := cfg.tracer; tracer != nil && (started || !op.completed.IsSet()) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		tracer.Requested(ctx, operationId, started)
+	}
+	switch {
+	case started:
+		atomic.AddUint64(&f.counters.executions, 1)
+		if m != nil {
+			m.OnExecute(operationId)
+		}
+		if logger != nil {
+			logger.Debugf("funnel %s: operation %s started", cfg.name, operationId)
+		}
+	case op.completed.IsSet():
+		atomic.AddUint64(&f.counters.cacheHits, 1)
+		if m != nil {
+			m.OnCacheHit(operationId)
+		}
+		if logger != nil {
+			logger.Debugf("funnel %s: request served with the cached result of operation %s", cfg.name, operationId)
+		}
+	default:
+		atomic.AddUint64(&f.counters.coalesced, 1)
+		if m != nil {
+			m.OnCoalesced(operationId)
+		}
+		if logger != nil {
+			logger.Debugf("funnel %s: request joined operation %s in process", cfg.name, operationId)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package funnel
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingMetrics counts the notifications by their name and operation identifier.
+type countingMetrics struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+func (m *countingMetrics) count(event, operationId string) {
+	m.Lock()
+	defer m.Unlock()
+	m.counts[event+" "+operationId]++
+}
+
+func (m *countingMetrics) OnExecute(operationId string)   { m.count("execute", operationId) }
+func (m *countingMetrics) OnCoalesced(operationId string) { m.count("coalesced", operationId) }
+func (m *countingMetrics) OnCacheHit(operationId string)  { m.count("hit", operationId) }
+func (m *countingMetrics) OnTimeout(operationId string)   { m.count("timeout", operationId) }
+func (m *countingMetrics) OnPanic(operationId string)     { m.count("panic", operationId) }
+
+func TestWithMetrics(t *testing.T) {
+	m := &countingMetrics{counts: map[string]int{}}
+	fnl := New(WithCacheTtl(time.Hour), WithTimeout(time.Millisecond*50), WithMetrics(m))
+
+	release := make(chan empty)
+	var wg sync.WaitGroup
+	numOfGoroutines := 5
+	wg.Add(numOfGoroutines)
+	for i := 0; i < numOfGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			fnl.Execute("opId", func() (interface{}, error) {
+				<-release
+				return "res", nil
+			})
+		}()
+	}
+	assert.Eventually(t, func() bool { return fnl.Dump().Waiters == numOfGoroutines }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	fnl.Execute("opId", nil)
+
+	fnl.Execute("slow", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 100)
+		return nil, nil
+	})
+	assert.Panics(t, func() {
+		fnl.Execute("panicked", func() (interface{}, error) { panic("test ends with panic") })
+	})
+
+	assert.Eventually(t, func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return m.counts["panic panicked"] == 1
+	}, time.Second, time.Millisecond)
+	m.Lock()
+	defer m.Unlock()
+	assert.Equal(t, map[string]int{
+		"execute opId":     1,
+		"coalesced opId":   numOfGoroutines - 1,
+		"hit opId":         1,
+		"execute slow":     1,
+		"timeout slow":     1,
+		"execute panicked": 1,
+		"panic panicked":   1,
+	}, m.counts)
+}
+
+// recordingLogger records the logged lines.
+type recordingLogger struct {
+	sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) logged() []string {
+	l.Lock()
+	defer l.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestWithLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	fnl := New(WithName("logged"), WithCacheTtl(time.Hour), WithTimeout(time.Millisecond*20), WithMaxEntries(1), WithLogger(logger))
+
+	fnl.Execute("opId", func() (interface{}, error) { return nil, nil })
+	fnl.Execute("opId", nil)
+	fnl.Execute("other", func() (interface{}, error) { return nil, nil })
+	fnl.Execute("slow", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 50)
+		return nil, nil
+	})
+	assert.Panics(t, func() {
+		fnl.Execute("panicked", func() (interface{}, error) { panic("test ends with panic") })
+	})
+
+	for _, line := range []string{
+		"funnel logged: operation opId started",
+		"funnel logged: operation opId completed, error: <nil>, cached: true",
+		"funnel logged: request served with the cached result of operation opId",
+		"funnel logged: operation opId evicted",
+		"funnel logged: request timed out waiting for operation slow",
+		"funnel logged: operation panicked panicked: test ends with panic",
+	} {
+		assert.Contains(t, logger.logged(), line)
+	}
+
+	// A request joining an operation in process.
+	release := make(chan empty)
+	go fnl.Execute("joined", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("joined") }, time.Second, time.Millisecond)
+	go fnl.Execute("joined", nil)
+	assert.Eventually(t, func() bool {
+		for _, line := range logger.logged() {
+			if line == "funnel logged: request joined operation joined in process" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+	close(release)
+}
@@ -0,0 +1,73 @@
+package funnel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// expiredSet remembers the operations whose cached result expired, until the near-miss grace after their expiry
+// elapses (see WithNearMissGrace). It is not safe for concurrent use, the funnel's lock guards it.
+type expiredSet struct {
+	// graceEnds maps an identifier to the end of the grace after its expiry, and queue holds the identifiers by the
+	// end of their grace, the earliest first.
+	graceEnds map[string]time.Time
+	queue     []expiredEntry
+}
+
+type expiredEntry struct {
+	operationId string
+	graceEnd    time.Time
+}
+
+func newExpiredSet() *expiredSet {
+	return &expiredSet{graceEnds: make(map[string]time.Time)}
+}
+
+// expired records that the cached result of the operation expired at the given time.
+func (s *expiredSet) expired(operationId string, expiresAt time.Time, grace time.Duration) {
+	graceEnd := expiresAt.Add(grace)
+	s.graceEnds[operationId] = graceEnd
+	s.queue = append(s.queue, expiredEntry{operationId: operationId, graceEnd: graceEnd})
+}
+
+// recreated reports whether the operation is recreated within the grace after its expiry, and forgets its expiry.
+func (s *expiredSet) recreated(operationId string, now time.Time) bool {
+	s.prune(now)
+	graceEnd, found := s.graceEnds[operationId]
+	delete(s.graceEnds, operationId)
+	return found && !now.After(graceEnd)
+}
+
+// prune forgets the expiries whose grace ended, so that the set holds only the operations expired within the grace.
+func (s *expiredSet) prune(now time.Time) {
+	i := 0
+	for ; i < len(s.queue) && now.After(s.queue[i].graceEnd); i++ {
+		entry := s.queue[i]
+		// The identifier may have expired again since, with a later end of grace.
+		if s.graceEnds[entry.operationId] == entry.graceEnd {
+			delete(s.graceEnds, entry.operationId)
+		}
+	}
+	s.queue = append(s.queue[:0], s.queue[i:]...)
+}
+
+// removedExpired records the expiry of the cached result of the operation being removed, if it expired and near-misses
+// are tracked (see WithNearMissGrace). Must be called with the lock held.
+func (f *Funnel) removedExpired(op *operationInProcess) {
+	grace := op.config.nearMissGrace
+	if grace <= 0 || op.expiresAt.IsZero() || time.Now().Before(op.expiresAt) {
+		return
+	}
+	if f.expired == nil {
+		f.expired = newExpiredSet()
+	}
+	f.expired.expired(op.operationId, op.expiresAt, grace)
+}
+
+// created counts a near-miss if the operation, just created, is recreated within the grace after its expiry.
+// Must be called with the lock held.
+func (f *Funnel) created(operationId string) {
+	if f.expired != nil && f.expired.recreated(operationId, time.Now()) {
+		atomic.AddUint64(&f.counters.nearMisses, 1)
+	}
+}
@@ -1,10 +1,16 @@
 package funnel
 
-import "time"
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
 
 type Option func(*Config)
 
 // WithTimeout defines the maximum time that goroutines will wait for ending of operation (the default is one minute)
+// A goroutine that waited for the timeout receives ErrTimeout.
 func WithTimeout(t time.Duration) Option {
 	return func(cfg *Config) {
 		cfg.timeout = t
@@ -12,6 +18,8 @@ func WithTimeout(t time.Duration) Option {
 }
 
 // WithCacheTtl defines the time for which the result can remain cached (the default is 0 )
+// A time-to-live of 0 prohibits caching, and a negative one is inconsistent: New (and NewConfig) panics.
+// The time-to-live is absolute, from the completion of the operation, see WithSlidingCacheTtl for a sliding one.
 func WithCacheTtl(cTtl time.Duration) Option {
 	return func(cfg *Config) {
 		cfg.cacheTtl = cTtl
@@ -20,8 +28,570 @@ func WithCacheTtl(cTtl time.Duration) Option {
 
 // WithShouldCachePredicate allows more control over which responses should be cached.
 // If this option is used responses from execute will only be cached if the predicate provided returns true.
+// Regardless of the predicate, a response whose error is (or wraps) a context's cancellation or deadline error is never cached.
 func WithShouldCachePredicate(p func(interface{}, error) bool) Option {
 	return func(cfg *Config) {
 		cfg.shouldCache = p
 	}
 }
+
+// WithConcurrencyBudget limits the total cost of the operations executing concurrently (the default is unlimited).
+// Operations started by Execute cost 1, use ExecuteWithCost to assign a different cost to heavier operations.
+// Operations waiting for their turn are admitted in arrival order, and waiting for admission counts towards the timeout.
+// With the default cost, the budget is the maximum number of distinct operations executing at once. Requests joining an
+// operation in process don't consume the budget, and an execution releases its cost once it returns or panics.
+func WithConcurrencyBudget(total int) Option {
+	return func(cfg *Config) {
+		cfg.concurrencyBudget = total
+	}
+}
+
+// WithMaxConcurrency limits the number of distinct operations executing concurrently (the default is unlimited). It's
+// the concurrency budget of WithConcurrencyBudget for operations of the default cost of 1, the operations started by
+// ExecuteWithCost still consume their cost.
+func WithMaxConcurrency(n int) Option {
+	return WithConcurrencyBudget(n)
+}
+
+// WithColdMissAsync defines whether requests should return immediately when the operation's result is not cached yet.
+// When enabled, a request that finds no completed result returns ErrColdCache while the operation executes in the
+// background (only once for all the concurrent requests), and the requests following its completion get the cached result.
+func WithColdMissAsync(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.coldMissAsync = enabled
+	}
+}
+
+// WithCodec defines how results are serialized when they need to be stored outside of the process memory, e.g. in an
+// external cache (see WithCache) or to validate them (see WithValidateSerializable).
+// enc must be able to encode every result that should be cached, and dec must restore a result from its encoding.
+func WithCodec(enc func(interface{}) ([]byte, error), dec func([]byte) (interface{}, error)) Option {
+	return func(cfg *Config) {
+		cfg.encode = enc
+		cfg.decode = dec
+	}
+}
+
+// WithValidateSerializable defines whether results should be test-encoded with the codec (see WithCodec), and decoded
+// back when the codec has a decoder, before being cached. It requires a codec, New panics otherwise.
+// A result that fails to encode or decode (including when the codec panics) is still returned to the waiting goroutines
+// but it is not cached, and the failure is reported to the internal error handler (see WithOnInternalError).
+// Results of operations that returned an error are not validated.
+func WithValidateSerializable(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.validateSerializable = enabled
+	}
+}
+
+// WithOnInternalError defines a function that is notified of errors the funnel encounters while handling an operation
+// and that can't be returned to any caller. The reported errors are of type *InternalError, which carries the funnel's name.
+// The function is called synchronously and should return quickly.
+func WithOnInternalError(handler func(operationId string, err error)) Option {
+	return func(cfg *Config) {
+		cfg.onInternalError = handler
+	}
+}
+
+// WithName defines the name of the funnel, which is included in the events the funnel reports (such as the Funnel field of
+// InternalError) so that several funnels in the same process can be told apart (the default is a generated name such as "funnel-1").
+func WithName(name string) Option {
+	return func(cfg *Config) {
+		cfg.name = name
+	}
+}
+
+// WithPerKeyRate limits the rate at which each operation may be executed with a token bucket per operation identifier:
+// executions may burst up to burst at once, and are otherwise limited to r per second (the default is unlimited).
+// A burst smaller than 1 is treated as 1, since an empty bucket would never allow any execution.
+// A request that would start a new execution when the operation's bucket is empty returns ErrRateLimited, while requests
+// for a cached result or for an operation in process are never limited. There is no stale result to serve instead,
+// since the funnel doesn't retain a result once it's deleted.
+// Buckets are kept for the 10000 most recently executed identifiers; an identifier whose bucket was dropped starts
+// again with a full bucket.
+func WithPerKeyRate(r rate.Limit, burst int) Option {
+	return func(cfg *Config) {
+		if burst < 1 {
+			burst = 1
+		}
+		cfg.perKeyRate = r
+		cfg.perKeyBurst = burst
+	}
+}
+
+// WithOnPanic defines a function that is notified of every panic recovered from an operation, with the recovered value.
+// The function is called once per panicking execution, after the waiting goroutines were released, and should return quickly.
+// The panic of an execution that returned after its operation was deleted (e.g. after a timeout, or by Forget or Cancel),
+// which may have nobody left to receive it, is also reported to the internal error handler (see WithOnInternalError).
+func WithOnPanic(handler func(operationId string, recovered interface{})) Option {
+	return func(cfg *Config) {
+		cfg.onPanic = handler
+	}
+}
+
+// WithServeStaleOnPanic defines whether the waiters of an operation whose execution panics should receive the last good
+// result of the same operation instead of panicking. The stale result is returned with ErrServedStale so that it can be
+// told apart, it isn't cached (the next request re-executes the operation), and the panic is still reported (see WithOnPanic).
+// A good result is one that was cached without error. When enabled, the last good result of every operation identifier is
+// kept, even after it expired, until the operation is forgotten; mind the memory with high-cardinality identifiers.
+func WithServeStaleOnPanic(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.serveStaleOnPanic = enabled
+	}
+}
+
+// WithIdentityFunc defines how ExecuteIdentity derives an operation's identifier from its arguments, for arguments that
+// can't be trivially turned into a string (the default accepts a string or a fmt.Stringer only).
+// The function returns ok false for arguments that should not be coalesced, in which case the operation runs standalone.
+func WithIdentityFunc(identity func(args interface{}) (key string, ok bool)) Option {
+	return func(cfg *Config) {
+		cfg.identity = identity
+	}
+}
+
+// WithHedging defines that an execution which didn't return within delay is hedged by another concurrent execution of
+// the same operation, and so on every delay up to maxHedges additional executions (the default is no hedging).
+// The result of the first execution to return is delivered to all the waiting goroutines and cached, the results of the
+// other executions are discarded. Hedging trades extra load on the operation's upstream for a lower tail latency, so it
+// suits idempotent operations only. Additional executions are not charged to the concurrency budget.
+func WithHedging(delay time.Duration, maxHedges int) Option {
+	return func(cfg *Config) {
+		cfg.hedgeDelay = delay
+		cfg.maxHedges = maxHedges
+	}
+}
+
+// WithAuditSink defines a sink that receives a record of every execution of an operation, whether it succeeded, failed
+// or panicked, including executions that returned after their operation was deleted. Executions abandoned before they
+// started are not recorded.
+func WithAuditSink(sink AuditSink) Option {
+	return func(cfg *Config) {
+		cfg.auditSink = sink
+	}
+}
+
+// WithKeyExtractor defines a function that extracts the stable identity of an operation from the identifier passed by
+// the caller, for identifiers that are structured and contain volatile parts which shouldn't affect the operation's
+// identity (e.g. parsing an URL and dropping a timestamp or request id query parameter). Requests whose identifiers
+// extract to the same identity are coalesced, share the cached result and are forgotten together.
+// The extractor is applied to every identifier passed to the funnel, including dependencies (see ExecuteWithDeps),
+// and the extracted identity is the one reported by the funnel (e.g. in InternalError and AuditRecord).
+// It is called synchronously on every request, and must be deterministic.
+func WithKeyExtractor(extract func(rawKey string) string) Option {
+	return func(cfg *Config) {
+		cfg.extractKey = extract
+	}
+}
+
+// WithWaiterRetries defines the number of times a request that timed out waiting for an operation retries, by waiting
+// again on a fresh execution of the operation (the default is 0). The timed out execution is abandoned as usual.
+// Each attempt waits up to the timeout, so a request waits at most (n+1) times the timeout before it returns the
+// timeout error. It doesn't apply to Promises, nor to requests that don't wait (see WithColdMissAsync).
+func WithWaiterRetries(n int) Option {
+	return func(cfg *Config) {
+		cfg.waiterRetries = n
+	}
+}
+
+// WithMaxEntries limits the number of cached results (the default is unlimited). Once a newly cached result exceeds the
+// maximum, a cached result is evicted according to the eviction policy (see WithEvictionPolicy), as if it expired.
+// Operations in process are not counted.
+func WithMaxEntries(n int) Option {
+	return func(cfg *Config) {
+		cfg.maxEntries = n
+	}
+}
+
+// WithEvictionPolicy defines which cached result is evicted once the maximum number of cached results is exceeded
+// (see WithMaxEntries). The default is PolicyLRU; PolicyLFU improves the hit rate of skewed workloads, where some
+// operations are requested much more frequently than others.
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(cfg *Config) {
+		cfg.evictionPolicy = policy
+	}
+}
+
+// WithOnWastedWait defines a function that is notified of the requests that joined an operation in process, rather than
+// starting it, and timed out waiting for it, with the time the request waited. Since the timeout is measured from the
+// start of the operation, a request joining a stuck operation late waits only for the remainder and gets nothing,
+// where executing the operation itself might have succeeded. Frequent notifications identify operations for which
+// coalescing hurts the callers. The function is called synchronously by the timed out request and should return quickly.
+func WithOnWastedWait(handler func(operationId string, waited time.Duration)) Option {
+	return func(cfg *Config) {
+		cfg.onWastedWait = handler
+	}
+}
+
+// WithLoader defines the loader used by GetOrLoad to load the value of a key that is not cached, for funnels used as a
+// read-through cache where the load is uniform across keys.
+func WithLoader(loader Loader) Option {
+	return func(cfg *Config) {
+		cfg.loader = loader
+	}
+}
+
+// WithBatchLoader defines the batch loader used by GetOrLoadAll to load, with a single call, the values of all the
+// requested keys that are not cached nor being loaded.
+func WithBatchLoader(loader BatchLoader) Option {
+	return func(cfg *Config) {
+		cfg.batchLoader = loader
+	}
+}
+
+// WithCopyCache defines whether ExecuteAndCopyResult copies the result of each execution once, sharing the copy among
+// all of its callers, instead of making a copy per caller (the default). It saves the copy work when many callers copy
+// the same result, at the cost of a weaker isolation: the copy is isolated from the result returned by Execute and from
+// the copies of other executions of the operation (e.g. after expiry), but all the copy-callers served by the same
+// execution share a single object, so none of them may modify it.
+func WithCopyCache(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.copyCache = enabled
+	}
+}
+
+// WithRetryBackoff defines that an execution that returns an error is retried with an exponential backoff (the default
+// is no retry): the delay before the first retry is initial, and each following delay is multiplied by multiplier, up
+// to max. Each delay is reduced by a random part of up to jitter of it (a jitter of 1 is full jitter, 0 none), so that
+// the retries of many operations don't synchronize. Retries stop, regardless of their number, once the next one would
+// start after maxElapsed since the first execution; a maxElapsed of 0 disables retries.
+// Only the final outcome is delivered to the waiting goroutines, and the backoff counts towards their timeout.
+// Cancellation errors and panics are not retried, nor are operations deleted meanwhile (e.g. after a timeout).
+func WithRetryBackoff(initial, max time.Duration, multiplier float64, jitter float64, maxElapsed time.Duration) Option {
+	return func(cfg *Config) {
+		if maxElapsed <= 0 {
+			cfg.retryBackoff = nil
+			return
+		}
+		cfg.retryBackoff = &retryBackoff{initial: initial, max: max, multiplier: multiplier, jitter: jitter, maxElapsed: maxElapsed}
+	}
+}
+
+// WithRetry defines that an execution that returns an error is retried up to the given number of times (the default is
+// no retry), waiting before each retry for the delay returned by backoff for the attempt, counting the first retry as
+// attempt 1. A number of retries of 0 or less disables retries. Like with WithRetryBackoff, which it replaces, only the
+// final outcome is delivered to the waiting goroutines and considered for caching (see WithShouldCachePredicate), and
+// cancellation errors, panics and operations deleted meanwhile are not retried.
+func WithRetry(retries int, backoff func(attempt int) time.Duration) Option {
+	return func(cfg *Config) {
+		if retries <= 0 {
+			cfg.retryBackoff = nil
+			return
+		}
+		cfg.retryBackoff = &retryBackoff{retries: retries, backoff: backoff}
+	}
+}
+
+// WithSizeFunc defines a function estimating the size, in bytes, of a result, called once for each result that should
+// be cached. The sizes of the cached results are reported by Dump, in total and by operation, to identify the operations
+// that dominate the cache memory. Sizes are not computed without a size function (the default).
+func WithSizeFunc(sizeFunc func(res interface{}) int) Option {
+	return func(cfg *Config) {
+		cfg.sizeFunc = sizeFunc
+	}
+}
+
+// WithSynchronous defines whether a request that starts an execution runs the operation on its own goroutine, rather
+// than on a new one while it waits (the default). It suits single-goroutine use (e.g. command line tools and tests)
+// where the results should be cached but the coalescing goroutine is pure overhead. Requests for a cached result or for
+// an operation executed by another goroutine are served as usual, so concurrent use remains safe; but the request
+// executing the operation is not bound by the timeout, and WithColdMissAsync has no effect on it. Submit and
+// GetOrLoadAll always execute asynchronously.
+func WithSynchronous(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.synchronous = enabled
+	}
+}
+
+// WithCacheableError defines which errors returned by operations are cached, for negative caching with discrimination
+// (the default caches every error). When an operation returns an error, its result is cached for the cache time-to-live
+// only if the function returns true (e.g. for a definitive not found), and otherwise deleted right away so that the
+// next request re-executes the operation (e.g. after a transient failure). Cancellation errors are never cached.
+// The should-cache predicate (see WithShouldCachePredicate) must accept the result as well.
+func WithCacheableError(cacheable func(err error) bool) Option {
+	return func(cfg *Config) {
+		cfg.cacheableError = cacheable
+	}
+}
+
+// WithNegativeCacheTtl defines the time for which a result with an error, if it should be cached (see
+// WithCacheableError), remains cached instead of the cache time-to-live (the default is the cache time-to-live).
+// It lets errors be cached briefly while successful results are cached longer. A time to live of 0 prohibits caching
+// errors, and a negative one is inconsistent, like with WithCacheTtl.
+// With a negative cache time-to-live a panic is never cached: the goroutines waiting for the operation receive it, and
+// the next request re-executes the operation.
+func WithNegativeCacheTtl(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.negativeCacheTtl = d
+		cfg.hasNegativeCacheTtl = true
+	}
+}
+
+// WithOnExecuted defines a function that is notified of every execution that returned (without panic), with the
+// execution's context and the number of requests coalesced into the execution so far, including the initiator.
+// It is called on the execution's goroutine before the result is delivered, while the initiator still waits, so it can
+// annotate the initiator's span found in the context (see ExecuteContext). Operations started without a context get
+// the background context. The function should return quickly, the waiting requests are released once it returns.
+func WithOnExecuted(handler func(ctx context.Context, operationId string, served int)) Option {
+	return func(cfg *Config) {
+		cfg.onExecuted = handler
+	}
+}
+
+// WithAdmissionController defines a function that is consulted before starting a new execution of an operation, to
+// integrate with an external capacity signal (e.g. an adaptive concurrency limit or a quota). When it returns false the
+// request returns ErrRejected, while requests for a cached result or for an operation in process are always served.
+// The function is called without holding the funnel's lock; if another request starts the operation meanwhile, the
+// request joins it regardless of the function's decision.
+func WithAdmissionController(admit func(operationId string) bool) Option {
+	return func(cfg *Config) {
+		cfg.admit = admit
+	}
+}
+
+// WithOnFirstSeen defines a function that is notified the first time an operation with a given identifier is created,
+// and not when it's created again after its result expired, for initializing per-identifier resources lazily (e.g.
+// registering metrics). The function is called by the request that created the operation, possibly while the operation
+// executes, and should return quickly.
+// The funnel remembers the 10000 most recently created identifiers, so it holds up to 10000 identifiers in memory, and an
+// identifier that was not created for longer than that is notified again once it's created again.
+func WithOnFirstSeen(handler func(operationId string)) Option {
+	return func(cfg *Config) {
+		cfg.onFirstSeen = handler
+	}
+}
+
+// WithPerKeyConcurrency defines the maximum number of executions of an operation that may run concurrently (the default
+// is 1): while fewer executions of an operation are in process, a request for it starts another execution rather than
+// joining the one in process, and once the maximum is reached the requests are distributed in turn among the executions
+// in process. This trades duplicate work for a lower latency of the requests joining a slow execution, each waiter
+// receiving the result of the execution it joined. A single result is cached, see WithConcurrentResultPolicy.
+// The additional executions are neither rate limited nor submitted to the admission controller, and they don't record
+// dependencies; Cancel cancels only the execution the funnel holds, the first one until another provides the result.
+func WithPerKeyConcurrency(n int) Option {
+	return func(cfg *Config) {
+		cfg.perKeyConcurrency = n
+	}
+}
+
+// WithConcurrentResultPolicy defines which of the concurrent executions of an operation (see WithPerKeyConcurrency)
+// provides the result cached and served to the later requests. The default is FirstWins.
+func WithConcurrentResultPolicy(policy ConcurrentResultPolicy) Option {
+	return func(cfg *Config) {
+		cfg.concurrentResultPolicy = policy
+	}
+}
+
+// WithShrinkingDeadline defines that the deadline of an operation in process follows the deadlines of the requests
+// waiting for it, rather than the timeout measured from the start of the operation: each waiter waits until the timeout
+// or the deadline of its context (see ExecuteContext), whichever comes first, and each time a waiter leaves, the
+// operation's deadline is recomputed as the latest deadline of the remaining waiters. Once no waiter remains, the
+// operation is deleted as if it timed out, and its execution's context is canceled, so that an operation whose waiters
+// all gave up early doesn't keep running until the timeout. The next request re-executes the operation.
+// Promises (see Submit) count as waiters only while awaited.
+func WithShrinkingDeadline(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.shrinkingDeadline = enabled
+	}
+}
+
+// WithCancelAbandoned defines that once all the requests waiting for an operation in process gave up, whether they
+// timed out or their context is done, the context of the operation's execution (see ExecuteContext) is canceled with
+// ErrAbandoned as its cause, so that the execution can abort the work whose result nobody will read. The funnel counts
+// the waiters of each operation for that. Promises (see Submit) count as waiters only while awaited, and an operation
+// that nobody waited for yet is never abandoned.
+func WithCancelAbandoned(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.cancelAbandoned = enabled
+	}
+}
+
+// WithMapCompaction defines that the funnel reclaims the memory of the map holding its operations after a burst: Go maps
+// never shrink, so once the results of a burst of distinct operations expired, the map keeps the footprint of the burst.
+// Once the number of operations held falls below a quarter of its peak, and remains so for the stable period, the map is
+// rebuilt into a map sized for the remaining operations. Growing back above a quarter of the peak meanwhile cancels the
+// compaction, so that a churning workload isn't rebuilt over and over. Maps of fewer than 1024 operations are never
+// compacted. The default stable period of 0 disables compaction.
+func WithMapCompaction(stable time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.compactAfter = stable
+	}
+}
+
+// WithWriteBehind defines a function that writes the results cached by the funnel behind, e.g. to an external cache
+// shared with other instances, with the result's cache time-to-live. The function is called asynchronously once the
+// result is cached, so that it doesn't delay the waiting goroutines, by a pool of up to 4 goroutines. It is called once
+// per cached result, and not for the results that are not cached (see WithShouldCachePredicate). Up to 1024 results
+// wait for the pool to write them; beyond that, and when the function panics, the failure is reported to the internal
+// error handler (see WithOnInternalError).
+func WithWriteBehind(write func(operationId string, res interface{}, err error, ttl time.Duration)) Option {
+	return func(cfg *Config) {
+		cfg.writeBehind = write
+	}
+}
+
+// WithReadThrough defines a function that looks the result of an operation up in an external cache (e.g. one populated
+// by other instances, see WithWriteBehind) before executing it: when the function returns true, its result and error are
+// used instead of executing the operation, and cached as if the operation returned them. The lookup is made by the
+// execution, so the requests coalesced with it wait for a single lookup, followed by the execution on a miss. The results
+// read through are not written behind. A panic of the function is the operation's panic.
+func WithReadThrough(read func(operationId string) (res interface{}, err error, ok bool)) Option {
+	return func(cfg *Config) {
+		cfg.readThrough = read
+	}
+}
+
+// WithGlobalFlushInterval defines that all the cached results are deleted every interval, regardless of their cache
+// time-to-live, as a coarse backstop for the consistency of the cache. The operations in process are not affected, and
+// the results they cache are deleted by the following flush. The flush runs on a goroutine of the funnel until the funnel
+// is closed (see Close). The default interval of 0 disables the global flush.
+func WithGlobalFlushInterval(interval time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.globalFlushInterval = interval
+	}
+}
+
+// WithPanicAsError defines a function that converts the value recovered from the panic of an operation into the error
+// that the goroutines waiting for the operation receive, instead of panicking in each of them (the default). Like any
+// panic, the error is not cached, so that the next request re-executes the operation; the panic is still notified (see
+// WithOnPanic). When a last good result is served instead (see WithServeStaleOnPanic), the error is discarded.
+func WithPanicAsError(handler func(recovered interface{}) error) Option {
+	return func(cfg *Config) {
+		cfg.panicAsError = handler
+	}
+}
+
+// WithMetrics defines the metrics notified of the outcome of every request (an execution, a request coalesced with an
+// execution in process, or a cache hit), of every request that timed out and of every execution that panicked, so
+// that the funnel can be instrumented without depending on a metrics system.
+func WithMetrics(m Metrics) Option {
+	return func(cfg *Config) {
+		cfg.metrics = m
+	}
+}
+
+// WithPanicFormatter defines a function that makes the error describing the value recovered from the panic of an
+// operation, along with the stack of the panic, wherever the funnel converts a panic into an error: for the callbacks
+// of ExecuteWithCallback, and for the panics reported to the internal error handler (see WithOnInternalError). It lets
+// the recovered values be redacted, or the stacks be included. The default error is "operation <id> panicked: <value>".
+func WithPanicFormatter(format func(recovered interface{}, stack []byte) error) Option {
+	return func(cfg *Config) {
+		cfg.panicFormatter = format
+	}
+}
+
+// WithStaleWhileRevalidate defines the time beyond the cache time-to-live for which a successful result is served
+// stale (the default is 0, a result is never served stale). The first request for the operation past the cache
+// time-to-live starts an execution that refreshes the result in the background, rather than waiting for it: until the
+// refresh completes, all the requests are served with the stale result right away, and once it completes they are
+// served with the fresh one. Past the stale time, requests wait for a fresh execution as usual. The refresh is not
+// executed synchronously (see WithSynchronous); should its result not be cached, the stale result is dropped.
+func WithStaleWhileRevalidate(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.staleWhileRevalidate = d
+	}
+}
+
+// WithExpvar defines that the funnel's counters are published with the expvar package under the name, e.g. for the
+// /debug/vars endpoint: the requests that started an execution, were coalesced or served from the cache, the requests
+// that timed out, the executions that panicked, and the number of operations held (see Stats). The values are read live
+// from the counters when the variable is read. Like expvar.Publish, New panics if the name is already published.
+func WithExpvar(name string) Option {
+	return func(cfg *Config) {
+		cfg.expvarName = name
+	}
+}
+
+// WithBackend defines the backend through which the funnel broadcasts the explicit invalidations of its operations to
+// the other funnels sharing it, and receives theirs, to keep the funnels of several instances coherent: the operations
+// forgotten by Forget, ForgetIf or ForgetMatching are published, and each funnel forgets the operations it receives,
+// along with their dependents (see ExecuteWithDeps). Since a funnel receives its own invalidations as well, a result it
+// cached again between publishing and receiving the invalidation is forgotten too.
+func WithBackend(backend Backend) Option {
+	return func(cfg *Config) {
+		cfg.backend = backend
+	}
+}
+
+// WithSlidingCacheTtl defines the time for which the result can remain cached since the last request served it, for
+// read-through caches: unlike the absolute time-to-live of WithCacheTtl, each request served a cached result extends its
+// lifetime by the time-to-live. The options are mutually exclusive, New (and NewConfig) panics if both are given.
+// A result cached for the negative time-to-live doesn't slide (see WithNegativeCacheTtl), and neither does a stale
+// result served while being refreshed (see WithStaleWhileRevalidate).
+func WithSlidingCacheTtl(ttl time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.slidingCacheTtl = ttl
+	}
+}
+
+// WithCacheTtlJitter defines the fraction by which the cache time-to-live of each result is randomized, so that the
+// results cached at the same time don't all expire at the same time and cause a stampede of re-executions: a result is
+// cached for a random time between ttl*(1-fraction) and ttl*(1+fraction), drawn once the operation completed. The
+// jitter applies to the negative and sliding time-to-live as well (see WithNegativeCacheTtl and WithSlidingCacheTtl),
+// though the lifetime of a sliding result is extended by the time-to-live itself.
+// A fraction of 0 means no jitter (the default), and a fraction below 0 or above 1 is inconsistent: New (and NewConfig)
+// panics.
+func WithCacheTtlJitter(fraction float64) Option {
+	return func(cfg *Config) {
+		cfg.cacheTtlJitter = fraction
+	}
+}
+
+// WithCopyTimeout defines the maximum time for copying the result for ExecuteAndCopyResult (the default is 0, no
+// limit), to bound the latency of the callers on results that are expensive to copy. A caller whose copy exceeds the
+// timeout receives ErrCopyTimeout instead of the result, and the copy is abandoned but runs to completion in the
+// background, since it can't be interrupted; with a copy cache (see WithCopyCache) the copy made in the background is
+// served to the later copy-callers.
+func WithCopyTimeout(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.copyTimeout = d
+	}
+}
+
+// WithTtlFunc defines a function that decides the cache time-to-live of each result from the result itself, e.g. to
+// honor the freshness directives of an upstream (such as the max-age of a Cache-Control header). The time-to-live it
+// returns overrides the static ones (see WithCacheTtl, WithSlidingCacheTtl and WithNegativeCacheTtl), and a
+// time-to-live of 0 or less prohibits caching the result. The function is called only for the results that should be
+// cached otherwise (see WithShouldCachePredicate), once per execution and without holding the funnel's lock.
+func WithTtlFunc(ttlFunc func(res interface{}, err error) time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.ttlFunc = ttlFunc
+	}
+}
+
+// WithNearMissGrace defines the time after the expiry of a cached result within which re-creating its operation counts
+// as a near-miss (see Stats.NearMisses), for tuning the cache time-to-live: a high rate of near-misses means that a
+// slightly longer time-to-live would spare many re-executions. The default is 0, not tracking near-misses. The funnel
+// remembers each expired operation for the grace, so it holds the identifiers expired within the grace in memory.
+func WithNearMissGrace(grace time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.nearMissGrace = grace
+	}
+}
+
+// WithLogger defines the logger notified of the lifecycle of the operations, see Logger. Without a logger (the default)
+// nothing is logged nor formatted.
+func WithLogger(logger Logger) Option {
+	return func(cfg *Config) {
+		cfg.logger = logger
+	}
+}
+
+// WithTracer defines the tracer of the executions of the operations and of the requests for them, see Tracer.
+func WithTracer(tracer Tracer) Option {
+	return func(cfg *Config) {
+		cfg.tracer = tracer
+	}
+}
+
+// WithCache defines an external cache of the results of the operations, e.g. one shared by the instances of a service,
+// see Cache. An execution looks its result up in the cache before executing the operation, so the requests coalesced
+// with it wait for a single lookup; a result found is cached by the funnel as if the operation returned it, and is not
+// written back. The successful results the funnel caches (see WithShouldCachePredicate) are written through to the
+// cache with their time-to-live once cached, and the results of the operations forgotten (see Forget) are deleted from
+// it. A panic of the cache is reported to the internal error handler (see WithOnInternalError).
+// The results are encoded with the codec before being written to the cache, and decoded once read, except for a
+// MemoryCache which holds them as is. Any other cache requires a codec with a decoder, New panics otherwise.
+func WithCache(c Cache) Option {
+	return func(cfg *Config) {
+		cfg.externalCache = c
+	}
+}
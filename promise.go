@@ -0,0 +1,114 @@
+package funnel
+
+import "context"
+
+// A Promise is a handle to the result of an operation submitted to the funnel (see Submit). It can be awaited from
+// several goroutines and queried without blocking.
+type Promise struct {
+	f  *Funnel
+	op *operationInProcess
+
+	// The error that prevented the operation from being submitted, in which case op is nil.
+	err error
+}
+
+// closedDone is returned by Done when the operation could not be submitted.
+var closedDone = func() chan empty {
+	done := make(chan empty)
+	close(done)
+	return done
+}()
+
+// Submit is like Execute, but returns immediately with a Promise of the operation's result instead of waiting for it.
+// The operation is coalesced with identical operations exactly as with Execute.
+func (f *Funnel) Submit(operationId string, opExeFunc func() (interface{}, error)) *Promise {
+	op, err := f.getOperationInProcess(operationId, callConfig{cost: 1}, opExeFunc)
+	return &Promise{f: f, op: op, err: err}
+}
+
+// Await waits for the operation's result and returns it, like Execute does. It returns a *CanceledError carrying the
+// context's cause (see context.Cause) if the context is done first, and ErrTimeout if the funnel's timeout expires
+// first. Like Execute, if the operation ended with panic, Await panics the same way. Await may be called any number of
+// times, from any goroutine.
+func (p *Promise) Await(ctx context.Context) (interface{}, error) {
+	if p.op == nil {
+		return nil, p.err
+	}
+
+	res, opErr, deliveryErr := p.f.await(ctx, p.op, p.op.config.timeout, false)
+	if deliveryErr == timeoutError {
+		p.f.deleteTimedOut(p.op)
+	}
+	if deliveryErr != nil {
+		return nil, deliveryErr
+	}
+	return res, opErr
+}
+
+// Poll returns the operation's result without blocking. The last value is false when the operation is still in process,
+// in which case the result and error are nil. Like Await, if the operation ended with panic, Poll panics the same way.
+func (p *Promise) Poll() (interface{}, error, bool) {
+	if p.op == nil {
+		return nil, p.err, true
+	}
+
+	select {
+	case <-p.op.done:
+		if p.op.cancelErr != nil {
+			return nil, p.op.cancelErr, true
+		}
+		if p.op.panicErr != nil {
+			panic(p.op.panicErr)
+		}
+		return p.op.res, p.op.err, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// Done returns a channel that is closed once the operation's result is available (or the operation could not be submitted).
+func (p *Promise) Done() <-chan struct{} {
+	if p.op == nil {
+		return closedDone
+	}
+	return p.op.done
+}
+
+// ExecuteWithCallback is like Submit, but instead of returning a Promise it calls onDone with the result of the
+// operation once it's available, whether the operation was executed, joined or served from the cache. onDone is called
+// exactly once per call, on a goroutine of its own and without holding the funnel's lock. Since nobody receives a panic
+// of the operation, onDone receives an error describing it instead (see WithPanicFormatter).
+func (f *Funnel) ExecuteWithCallback(operationId string, opExeFunc func() (interface{}, error), onDone func(res interface{}, err error)) {
+	p := f.Submit(operationId, opExeFunc)
+	go func() {
+		res, err := p.awaitRecovered()
+		onDone(res, err)
+	}()
+}
+
+// A Result is the outcome of an operation delivered by ExecuteAsync.
+type Result struct {
+	Value interface{}
+	Err   error
+}
+
+// ExecuteAsync is like ExecuteWithCallback, but delivers the result of the operation on the returned channel, e.g. for
+// selecting over the results of several operations. The channel is buffered, it receives exactly one Result, once the
+// operation completed or the request timed out, and is never closed.
+func (f *Funnel) ExecuteAsync(operationId string, opExeFunc func() (interface{}, error)) <-chan Result {
+	results := make(chan Result, 1)
+	f.ExecuteWithCallback(operationId, opExeFunc, func(res interface{}, err error) {
+		results <- Result{Value: res, Err: err}
+	})
+	return results
+}
+
+// awaitRecovered is like Await without a context, but returns an error for the panic of the operation.
+func (p *Promise) awaitRecovered() (res interface{}, err error) {
+	defer func() {
+		if rr := recover(); rr != nil {
+			res, err = nil, p.op.panicError(rr)
+		}
+	}()
+	return p.Await(context.Background())
+}
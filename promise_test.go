@@ -0,0 +1,184 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromise(t *testing.T) {
+	fnl := New()
+
+	release := make(chan empty)
+	promise := fnl.Submit("opId", func() (interface{}, error) {
+		<-release
+		return "result", nil
+	})
+
+	res, err, ok := promise.Poll()
+	assert.False(t, ok)
+	assert.Nil(t, res)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	numOfGoroutines := 10
+	wg.Add(numOfGoroutines)
+	for i := 0; i < numOfGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			res, err := promise.Await(context.Background())
+			assert.Equal(t, "result", res)
+			assert.Nil(t, err)
+		}()
+	}
+
+	close(release)
+	<-promise.Done()
+	wg.Wait()
+
+	res, err, ok = promise.Poll()
+	assert.True(t, ok)
+	assert.Equal(t, "result", res)
+	assert.Nil(t, err)
+}
+
+func TestPromiseAwaitContext(t *testing.T) {
+	fnl := New()
+
+	release := make(chan empty)
+	defer close(release)
+	promise := fnl.Submit("opId", func() (interface{}, error) {
+		<-release
+		return "result", nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	res, err := promise.Await(ctx)
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, errors.Is(err, ErrCanceled))
+
+	// The operation is still in process for other callers.
+	assert.True(t, fnl.IsOpInProgress("opId"))
+}
+
+func TestPromiseTimeout(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond * 20))
+
+	release := make(chan empty)
+	defer close(release)
+	promise := fnl.Submit("opId", func() (interface{}, error) {
+		<-release
+		return "result", nil
+	})
+
+	_, err := promise.Await(context.Background())
+	assert.Equal(t, timeoutError, err)
+	assert.False(t, fnl.IsOpInProgress("opId"))
+}
+
+func TestExecuteWithCallback(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Minute))
+
+	type outcome struct {
+		caller int
+		res    interface{}
+		err    error
+	}
+	outcomes := make(chan outcome, 10)
+	release := make(chan empty)
+	numOfExecutions := 0
+	numOfCallers := 5
+	for i := 0; i < numOfCallers; i++ {
+		caller := i
+		fnl.ExecuteWithCallback("opId", func() (interface{}, error) {
+			numOfExecutions++
+			<-release
+			return "res", nil
+		}, func(res interface{}, err error) {
+			outcomes <- outcome{caller, res, err}
+		})
+	}
+	close(release)
+
+	// Each coalesced caller is called back once, and so is a caller served from the cache.
+	called := map[int]int{}
+	for i := 0; i < numOfCallers; i++ {
+		o := <-outcomes
+		assert.Equal(t, "res", o.res)
+		assert.Nil(t, o.err)
+		called[o.caller]++
+	}
+	fnl.ExecuteWithCallback("opId", nil, func(res interface{}, err error) {
+		outcomes <- outcome{numOfCallers, res, err}
+	})
+	o := <-outcomes
+	assert.Equal(t, outcome{numOfCallers, "res", nil}, o)
+	assert.Equal(t, numOfCallers, len(called))
+	for _, numOfCalls := range called {
+		assert.Equal(t, 1, numOfCalls)
+	}
+	assert.Equal(t, 1, numOfExecutions)
+
+	time.Sleep(time.Millisecond * 10)
+	assert.Empty(t, outcomes)
+}
+
+func TestExecuteWithCallbackPanic(t *testing.T) {
+	fnl := New()
+
+	errs := make(chan error)
+	fnl.ExecuteWithCallback("opId", func() (interface{}, error) {
+		panic("callback panic")
+	}, func(res interface{}, err error) {
+		assert.Nil(t, res)
+		errs <- err
+	})
+	assert.Contains(t, (<-errs).Error(), "callback panic")
+}
+
+func TestExecuteWithCallbackPanicFormatter(t *testing.T) {
+	redacted := errors.New("redacted")
+	stacks := make(chan []byte, 1)
+	fnl := New(WithPanicFormatter(func(recovered interface{}, stack []byte) error {
+		stacks <- stack
+		return redacted
+	}))
+
+	errs := make(chan error)
+	fnl.ExecuteWithCallback("opId", func() (interface{}, error) {
+		panic("secret")
+	}, func(res interface{}, err error) {
+		errs <- err
+	})
+	assert.Equal(t, redacted, <-errs)
+	assert.Contains(t, string(<-stacks), "TestExecuteWithCallbackPanicFormatter", "the stack is the panic's")
+}
+
+func TestExecuteAsync(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond * 50))
+
+	release := make(chan empty)
+	defer close(release)
+	fast := fnl.ExecuteAsync("fast", func() (interface{}, error) {
+		return "fast", nil
+	})
+	slow := fnl.ExecuteAsync("slow", func() (interface{}, error) {
+		<-release
+		return "slow", nil
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case res := <-fast:
+			assert.Equal(t, Result{"fast", nil}, res)
+		case res := <-slow:
+			assert.Equal(t, Result{nil, timeoutError}, res)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package funnel
+
+import (
+	"container/list"
+	"errors"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned when a request would start a new execution of an operation whose execution rate limit
+// (see WithPerKeyRate) is exhausted.
+var ErrRateLimited = errors.New("Execution rate limit of the operation exceeded")
+
+// maxRateLimitedKeys bounds the number of operation identifiers for which an execution rate limiter is kept.
+const maxRateLimitedKeys = 10000
+
+// keyRateLimiter holds a token bucket per operation identifier, keeping the most recently used ones when the number of
+// identifiers exceeds maxRateLimitedKeys. It is not safe for concurrent use, the funnel's lock guards it.
+type keyRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	// limiters maps an identifier to its element in the recency list, the front being the most recently used.
+	limiters map[string]*list.Element
+	recency  *list.List
+}
+
+// keyLimiter is the value held by the recency list.
+type keyLimiter struct {
+	operationId string
+	limiter     *rate.Limiter
+}
+
+func newKeyRateLimiter(limit rate.Limit, burst int) *keyRateLimiter {
+	return &keyRateLimiter{
+		limit:    limit,
+		burst:    burst,
+		limiters: make(map[string]*list.Element),
+		recency:  list.New(),
+	}
+}
+
+// allow reports whether an execution of the operation may start now, consuming a token if so.
+func (l *keyRateLimiter) allow(operationId string) bool {
+	elem, found := l.limiters[operationId]
+	if found {
+		l.recency.MoveToFront(elem)
+	} else {
+		if l.recency.Len() >= maxRateLimitedKeys {
+			oldest := l.recency.Back()
+			l.recency.Remove(oldest)
+			delete(l.limiters, oldest.Value.(*keyLimiter).operationId)
+		}
+		elem = l.recency.PushFront(&keyLimiter{operationId, rate.NewLimiter(l.limit, l.burst)})
+		l.limiters[operationId] = elem
+	}
+	return elem.Value.(*keyLimiter).limiter.Allow()
+}
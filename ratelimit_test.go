@@ -0,0 +1,85 @@
+package funnel
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// neverCache makes every request a cache miss, so that each one asks the rate limiter for a new execution.
+var neverCache = WithShouldCachePredicate(func(interface{}, error) bool {
+	return false
+})
+
+func TestPerKeyRateBurst(t *testing.T) {
+	fnl := New(WithPerKeyRate(rate.Every(time.Hour), 3), neverCache)
+
+	var numOfExecutions uint64
+	operation := func() (interface{}, error) {
+		atomic.AddUint64(&numOfExecutions, 1)
+		return "done", nil
+	}
+
+	for i := 0; i < 3; i++ {
+		res, err := fnl.Execute("hot", operation)
+		assert.Equal(t, "done", res)
+		assert.Nil(t, err)
+	}
+	res, err := fnl.Execute("hot", operation)
+	assert.Nil(t, res)
+	assert.Equal(t, ErrRateLimited, err)
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&numOfExecutions))
+
+	// Other operations have their own bucket.
+	res, err = fnl.Execute("cold", operation)
+	assert.Equal(t, "done", res)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), atomic.LoadUint64(&numOfExecutions))
+}
+
+func TestPerKeyRateSustained(t *testing.T) {
+	fnl := New(WithPerKeyRate(rate.Every(time.Millisecond*100), 1), neverCache)
+	operation := func() (interface{}, error) {
+		return "done", nil
+	}
+
+	executed := 0
+	deadline := time.Now().Add(time.Millisecond * 450)
+	for time.Now().Before(deadline) {
+		if _, err := fnl.Execute("hot", operation); err == nil {
+			executed++
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	// One token right away and one every 100ms afterwards.
+	assert.True(t, executed >= 4 && executed <= 6, "Expected the sustained rate to be enforced, executed ", executed)
+}
+
+func TestPerKeyRateZeroBurst(t *testing.T) {
+	fnl := New(WithPerKeyRate(10, 0), neverCache)
+
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return "done", nil
+	})
+	assert.Equal(t, "done", res)
+	assert.Nil(t, err)
+}
+
+func TestPerKeyRateLimitersBounded(t *testing.T) {
+	l := newKeyRateLimiter(rate.Every(time.Hour), 1)
+	assert.True(t, l.allow("recent"))
+	for i := 0; i < maxRateLimitedKeys*2; i++ {
+		l.allow(strconv.Itoa(i))
+		// Keeps "recent" among the most recently used identifiers.
+		l.allow("recent")
+	}
+
+	assert.Equal(t, maxRateLimitedKeys, len(l.limiters))
+	assert.Equal(t, maxRateLimitedKeys, l.recency.Len())
+	assert.False(t, l.allow("recent"), "The bucket of a recently used identifier should not be dropped")
+}
@@ -0,0 +1,34 @@
+package funnel
+
+// ExecuteWithReplaceableFunc is like Execute, but the function of the operation is replaceable: a request made with
+// ExecuteWithReplaceableFunc that joins the operation before its execution started replaces the operation's function
+// with its own, e.g. with fresher parameters. The execution starts right away, unless it waits for the concurrency
+// budget (see WithConcurrencyBudget), which makes the window in which the function can be replaced.
+// The function executed is deterministic: it's the function of the last request that joined the operation before the
+// execution started, in the order the requests took the funnel's lock, and the function is fixed once the execution
+// starts. The function of an operation started by another method is never replaced, and requests made by other methods
+// never replace the function.
+func (f *Funnel) ExecuteWithReplaceableFunc(operationId string, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
+	return f.execute(operationId, callConfig{cost: 1, replaceableFunc: true}, opExeFunc)
+}
+
+// replaceFunc replaces the function of the operation, unless its function is not replaceable or was already fixed.
+// Must be called with the lock held.
+func (op *operationInProcess) replaceFunc(opExeFunc func() (interface{}, error)) {
+	if op.replaceable && !op.funcFixed && opExeFunc != nil {
+		op.replacedFunc = opExeFunc
+	}
+}
+
+// fixFunc fixes the function of the replaceable operation once its execution starts, and returns it.
+func (f *Funnel) fixFunc(op *operationInProcess, opExeFunc func() (interface{}, error)) func() (interface{}, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	op.funcFixed = true
+	if op.replacedFunc != nil {
+		opExeFunc = op.replacedFunc
+		op.replacedFunc = nil
+	}
+	return opExeFunc
+}
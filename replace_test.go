@@ -0,0 +1,75 @@
+package funnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteWithReplaceableFunc(t *testing.T) {
+	fnl := New(WithConcurrencyBudget(1))
+
+	holding, release := make(chan empty), make(chan empty)
+	fnl.Submit("holder", func() (interface{}, error) {
+		close(holding)
+		<-release
+		return nil, nil
+	})
+	<-holding
+
+	// Within the window where the execution waits for the budget, the last replaceable function wins.
+	results := make(chan interface{}, 4)
+	request := func(res string, replaceable bool) {
+		opExeFunc := func() (interface{}, error) { return res, nil }
+		if replaceable {
+			r, _ := fnl.ExecuteWithReplaceableFunc("opId", opExeFunc)
+			results <- r
+		} else {
+			r, _ := fnl.Execute("opId", opExeFunc)
+			results <- r
+		}
+	}
+	go request("first", true)
+	assert.Eventually(t, func() bool { return fnl.IsExecuting("opId") }, time.Second, time.Millisecond)
+	for i, res := range []string{"second", "last"} {
+		go request(res, true)
+		assert.Eventually(t, func() bool { return fnl.Dump().Waiters == i+2 }, time.Second, time.Millisecond)
+	}
+	go request("not replaceable", false)
+	assert.Eventually(t, func() bool { return fnl.Dump().Waiters == 4 }, time.Second, time.Millisecond)
+	close(release)
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "last", <-results)
+	}
+}
+
+// Once the execution started, the function is fixed.
+func TestExecuteWithReplaceableFuncFixedOnStart(t *testing.T) {
+	fnl := New()
+
+	started, release := make(chan empty), make(chan empty)
+	go fnl.ExecuteWithReplaceableFunc("opId", func() (interface{}, error) {
+		close(started)
+		<-release
+		return "initiator", nil
+	})
+	<-started
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		close(release)
+	}()
+	res, _ := fnl.ExecuteWithReplaceableFunc("opId", func() (interface{}, error) {
+		return "late", nil
+	})
+	assert.Equal(t, "initiator", res)
+
+	// Functions of operations started by other methods are never replaced.
+	promise := fnl.Submit("other", func() (interface{}, error) { return "submitted", nil })
+	res, _ = fnl.ExecuteWithReplaceableFunc("other", func() (interface{}, error) { return "replaced", nil })
+	assert.Equal(t, "submitted", res)
+	res, _ = promise.Await(context.Background())
+	assert.Equal(t, "submitted", res)
+}
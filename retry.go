@@ -0,0 +1,53 @@
+package funnel
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// retryBackoff retries the failed executions of an operation with a jittered exponential backoff, see WithRetryBackoff,
+// or with the backoff function for up to a number of retries, see WithRetry.
+type retryBackoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+	maxElapsed time.Duration
+
+	// the maximum number of retries, unlimited when 0, and the function returning the delay before each retry.
+	retries int
+	backoff func(attempt int) time.Duration
+}
+
+// delay returns the delay before the given retry, counting from 0: the exponential delay capped at the maximum, less a
+// random part of up to jitter of it, or the delay returned by the backoff function for the retry's attempt.
+func (b *retryBackoff) delay(retry int) time.Duration {
+	if b.backoff != nil {
+		return b.backoff(retry + 1)
+	}
+	d := float64(b.initial) * math.Pow(b.multiplier, float64(retry))
+	if d > float64(b.max) {
+		d = float64(b.max)
+	}
+	return time.Duration(d * (1 - b.jitter*rand.Float64()))
+}
+
+// run executes the operation and retries it for as long as it fails, unless the next retry would start after the
+// maximum elapsed time or the maximum number of retries was reached. A cancellation error isn't retried, nor is an operation that was deleted meanwhile, since
+// nobody would receive its result. A panic is not retried either, it propagates right away.
+func (b *retryBackoff) run(op *operationInProcess, opExeFunc func() (interface{}, error)) (res interface{}, err error) {
+	start := time.Now()
+	for retry := 0; ; retry++ {
+		res, err = opExeFunc()
+		if err == nil || isCancellation(err) || op.deleted.IsSet() || (b.retries > 0 && retry == b.retries) {
+			return res, err
+		}
+
+		delay := b.delay(retry)
+		if b.maxElapsed > 0 && time.Since(start)+delay > b.maxElapsed {
+			return res, err
+		}
+		time.Sleep(delay)
+	}
+}
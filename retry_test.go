@@ -0,0 +1,95 @@
+package funnel
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoffDelays(t *testing.T) {
+	b := &retryBackoff{initial: time.Millisecond, max: time.Millisecond * 10, multiplier: 2}
+	var delays []time.Duration
+	for retry := 0; retry < 6; retry++ {
+		delays = append(delays, b.delay(retry))
+	}
+	assert.Equal(t, []time.Duration{
+		time.Millisecond, time.Millisecond * 2, time.Millisecond * 4, time.Millisecond * 8,
+		time.Millisecond * 10, time.Millisecond * 10,
+	}, delays)
+
+	b.jitter = 1
+	distinct := make(map[time.Duration]empty)
+	for i := 0; i < 100; i++ {
+		d := b.delay(10)
+		assert.True(t, d >= 0 && d <= b.max, "delay %v out of range", d)
+		distinct[d] = empty{}
+	}
+	assert.True(t, len(distinct) > 1, "delays should be jittered")
+}
+
+func TestWithRetryBackoff(t *testing.T) {
+	fnl := New(WithRetryBackoff(time.Millisecond, time.Millisecond*5, 2, 0.5, time.Second))
+
+	var numOfAttempts int32
+	transient := errors.New("transient error")
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		if atomic.AddInt32(&numOfAttempts, 1) < 3 {
+			return nil, transient
+		}
+		return "res", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "res", res)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&numOfAttempts))
+}
+
+func TestWithRetryBackoffMaxElapsed(t *testing.T) {
+	maxElapsed := time.Millisecond * 100
+	fnl := New(WithRetryBackoff(time.Millisecond*10, time.Millisecond*40, 2, 0, maxElapsed))
+
+	// Attempts at 0, 10, 30 and 70ms, the next one would start at 110ms.
+	var numOfAttempts int32
+	permanent := errors.New("permanent error")
+	start := time.Now()
+	_, err := fnl.Execute("opId", func() (interface{}, error) {
+		atomic.AddInt32(&numOfAttempts, 1)
+		return nil, permanent
+	})
+	assert.Equal(t, permanent, err)
+	assert.True(t, time.Since(start) < maxElapsed)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&numOfAttempts))
+}
+
+func TestWithRetry(t *testing.T) {
+	var attempts []int
+	fnl := New(WithCacheTtl(time.Hour), WithRetry(2, func(attempt int) time.Duration {
+		attempts = append(attempts, attempt)
+		return time.Millisecond
+	}), WithShouldCachePredicate(func(res interface{}, err error) bool {
+		return err == nil
+	}))
+
+	var numOfExecutions int32
+	permanent := errors.New("permanent error")
+	_, err := fnl.Execute("failing", func() (interface{}, error) {
+		atomic.AddInt32(&numOfExecutions, 1)
+		return nil, permanent
+	})
+	assert.Equal(t, permanent, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&numOfExecutions), "the execution and 2 retries")
+	assert.Equal(t, []int{1, 2}, attempts)
+	assert.False(t, fnl.IsOpInProgress("failing"), "the final error is not cached by the predicate")
+
+	res, err := fnl.Execute("recovering", func() (interface{}, error) {
+		if atomic.AddInt32(&numOfExecutions, 1) < 5 {
+			return nil, permanent
+		}
+		return "res", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "res", res)
+	assert.True(t, fnl.IsOpInProgress("recovering"))
+}
@@ -0,0 +1,19 @@
+package funnel
+
+import "github.com/intuit/funnel/internal/schedule"
+
+func init() {
+	schedule.WithScheduler = func(s schedule.Scheduler) interface{} {
+		return Option(func(cfg *Config) {
+			cfg.scheduler = s
+		})
+	}
+}
+
+// reach notifies the installed scheduler, if any, that an operation reached the given point.
+// In production no scheduler is installed and this costs nothing but a nil check.
+func (f *Funnel) reach(point schedule.Point, operationId string) {
+	if scheduler := f.currentConfig().scheduler; scheduler != nil {
+		scheduler.Reach(point, operationId)
+	}
+}
@@ -0,0 +1,35 @@
+package funnel
+
+import "container/list"
+
+// maxSeenIds bounds the number of operation identifiers remembered as seen, see WithOnFirstSeen.
+const maxSeenIds = 10000
+
+// seenSet remembers the most recently seen operation identifiers, up to maxSeenIds. It is not safe for concurrent use,
+// the funnel's lock guards it.
+type seenSet struct {
+	// ids maps an identifier to its element in the recency list, the front being the most recently seen.
+	ids     map[string]*list.Element
+	recency *list.List
+}
+
+func newSeenSet() *seenSet {
+	return &seenSet{ids: make(map[string]*list.Element), recency: list.New()}
+}
+
+// see records that the operation was seen, and reports whether it's the first time (or the first time since it was
+// dropped from the set).
+func (s *seenSet) see(operationId string) (first bool) {
+	if elem, found := s.ids[operationId]; found {
+		s.recency.MoveToFront(elem)
+		return false
+	}
+
+	if s.recency.Len() >= maxSeenIds {
+		oldest := s.recency.Back()
+		s.recency.Remove(oldest)
+		delete(s.ids, oldest.Value.(string))
+	}
+	s.ids[operationId] = s.recency.PushFront(operationId)
+	return true
+}
@@ -0,0 +1,35 @@
+package funnel
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithOnFirstSeen(t *testing.T) {
+	var mu sync.Mutex
+	firstSeen := make(map[string]int)
+	fnl := New(WithOnFirstSeen(func(operationId string) {
+		mu.Lock()
+		defer mu.Unlock()
+		firstSeen[operationId]++
+	}))
+	opExeFunc := func() (interface{}, error) { return nil, nil }
+
+	// The results are not cached, each request creates the operation again.
+	for i := 0; i < 3; i++ {
+		fnl.Execute("a", opExeFunc)
+		fnl.Execute("b", opExeFunc)
+	}
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, firstSeen)
+
+	// Once dropped from the seen identifiers, an identifier is notified again.
+	for i := 0; i < maxSeenIds; i++ {
+		fnl.Execute(strconv.Itoa(i), opExeFunc)
+	}
+	fnl.Execute("a", opExeFunc)
+	assert.Equal(t, 2, firstSeen["a"])
+	assert.Equal(t, maxSeenIds, fnl.seen.recency.Len())
+}
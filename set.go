@@ -0,0 +1,86 @@
+package funnel
+
+import (
+	"time"
+
+	"github.com/tevino/abool"
+)
+
+// Set caches the result for the operation as if an execution of the operation returned it, replacing the cached result
+// of the operation, if any, so that the following requests are served with it until its cache time-to-live elapses
+// (see WithCacheTtl and WithNegativeCacheTtl). Like the result of an execution, a result that should not be cached
+// (see WithShouldCachePredicate) is not.
+// Set does nothing while the operation is in process, the result of its execution taking precedence, see SetOrWait.
+// Returns whether the result was cached.
+func (f *Funnel) Set(operationId string, res interface{}, err error) bool {
+	return f.set(f.key(operationId), res, err, false)
+}
+
+// SetOrWait is like Set, but when the operation is in process it waits up to wait for the operation to complete, and
+// then replaces its result. The result set always takes precedence: should the operation still be in process once
+// the wait elapsed, it's deleted and the result set is cached instead. The goroutines waiting for the deleted
+// operation still receive the result of its execution, which is not cached.
+// Returns whether the result was cached.
+func (f *Funnel) SetOrWait(operationId string, res interface{}, err error, wait time.Duration) bool {
+	operationId = f.key(operationId)
+
+	f.Lock()
+	op, found := f.findOperation(operationId)
+	f.Unlock()
+
+	if found && !op.completed.IsSet() {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-op.done:
+		case <-timer.C:
+		}
+	}
+	return f.set(operationId, res, err, true)
+}
+
+// set caches the result for the operation, replacing an operation in process only when overriding.
+func (f *Funnel) set(operationId string, res interface{}, err error, override bool) bool {
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+
+	// Completed without holding the lock, since validating the result may report an internal error.
+	op := &operationInProcess{
+		operationId: operationId,
+		done:        make(chan empty),
+		opResult:    opResult{res: res, err: err},
+		startTime:   time.Now(),
+		deleted:     abool.New(),
+		completed:   abool.New(),
+		config:      f.currentConfig(),
+	}
+	close(op.done)
+	f.complete(op)
+	if !op.cacheable {
+		return false
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	if f.isClosed() {
+		return false
+	}
+	if existing, found := f.findOperation(operationId); found {
+		if !existing.completed.IsSet() && !override {
+			return false
+		}
+		// Like a forgotten operation, an operation in process is still executed for its waiters, even if its
+		// execution is still waiting for the concurrency budget.
+		existing.forgotten = !existing.completed.IsSet()
+		f.removeOperation(existing)
+	}
+	f.opInProcess[operationId] = op
+	f.grown()
+	notify = f.cache(op)
+	return true
+}
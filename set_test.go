@@ -0,0 +1,110 @@
+package funnel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	assert.True(t, fnl.Set("opId", "set", nil))
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return "executed", nil
+	})
+	assert.Equal(t, "set", res)
+	assert.Nil(t, err)
+
+	assert.True(t, fnl.Set("opId", "replaced", nil))
+	res, _ = fnl.Execute("opId", nil)
+	assert.Equal(t, "replaced", res)
+}
+
+func TestSetInProcess(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	go fnl.Execute("opId", func() (interface{}, error) {
+		<-release
+		return "executed", nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+
+	assert.False(t, fnl.Set("opId", "set", nil))
+	close(release)
+	res, _ := fnl.Execute("opId", nil)
+	assert.Equal(t, "executed", res)
+}
+
+func TestSetOrWaitOverwritesCompleted(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	results := make(chan interface{})
+	go func() {
+		res, _ := fnl.Execute("opId", func() (interface{}, error) {
+			<-release
+			return "executed", nil
+		})
+		results <- res
+	}()
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+
+	time.AfterFunc(time.Millisecond*20, func() { close(release) })
+	assert.True(t, fnl.SetOrWait("opId", "set", nil, time.Second))
+	assert.Equal(t, "executed", <-results)
+	res, _ := fnl.Execute("opId", nil)
+	assert.Equal(t, "set", res)
+}
+
+func TestSetOrWaitInstallsOnTimeout(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+
+	release := make(chan empty)
+	results := make(chan interface{})
+	go func() {
+		res, _ := fnl.Execute("opId", func() (interface{}, error) {
+			<-release
+			return "executed", nil
+		})
+		results <- res
+	}()
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+
+	assert.True(t, fnl.SetOrWait("opId", "set", nil, time.Millisecond*20))
+	res, _ := fnl.Execute("opId", nil)
+	assert.Equal(t, "set", res)
+
+	// The waiter of the deleted operation still receives its result, which doesn't replace the one set.
+	close(release)
+	assert.Equal(t, "executed", <-results)
+	res, _ = fnl.Execute("opId", nil)
+	assert.Equal(t, "set", res)
+}
+
+func TestSetOrWaitReplacesOperationWaitingForBudget(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithConcurrencyBudget(1))
+
+	release := make(chan empty)
+	go fnl.Execute("blocker", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsExecuting("blocker") }, time.Second, time.Millisecond)
+
+	results := make(chan interface{})
+	go func() {
+		res, _ := fnl.Execute("opId", func() (interface{}, error) { return "executed", nil })
+		results <- res
+	}()
+	assert.Eventually(t, func() bool { return fnl.IsOpInProgress("opId") }, time.Second, time.Millisecond)
+	assert.True(t, fnl.SetOrWait("opId", "set", nil, time.Millisecond*20))
+
+	// The operation replaced while waiting for the budget is still executed for its waiter.
+	close(release)
+	assert.Equal(t, "executed", <-results)
+	res, _ := fnl.Execute("opId", nil)
+	assert.Equal(t, "set", res)
+}
@@ -0,0 +1,29 @@
+package funnel
+
+import "time"
+
+// isStale reports whether the cached result of the operation is past its cache time-to-live, but may still be served
+// while being refreshed (see WithStaleWhileRevalidate). Must be called with the lock held, on an operation found in the
+// funnel.
+func (op *operationInProcess) isStale() bool {
+	return !op.freshUntil.IsZero() && !time.Now().Before(op.freshUntil)
+}
+
+// serving returns the operation whose result is served to the requests for the operation: the stale result while the
+// operation refreshes it, and the operation itself otherwise. Must be called with the lock held.
+func (op *operationInProcess) serving() *operationInProcess {
+	if op.stale != nil && !op.completed.IsSet() && time.Now().Before(op.stale.expiresAt) {
+		return op.stale
+	}
+	return op
+}
+
+// serveStale serves the stale result, if any, to a request that may not start the refresh of the operation, and
+// returns the error otherwise. Must be called with the lock held.
+func (f *Funnel) serveStale(stale *operationInProcess, err error) (*operationInProcess, bool, error) {
+	if stale == nil {
+		return nil, false, err
+	}
+	stale.served++
+	return stale, false, nil
+}
@@ -0,0 +1,58 @@
+package funnel
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithStaleWhileRevalidate(t *testing.T) {
+	cacheTtl := time.Millisecond * 50
+	fnl := New(WithCacheTtl(cacheTtl), WithStaleWhileRevalidate(time.Hour))
+
+	var numOfExecutions int32
+	release := make(chan empty)
+	opExeFunc := func() (interface{}, error) {
+		if atomic.AddInt32(&numOfExecutions, 1) == 1 {
+			return "stale", nil
+		}
+		<-release
+		return "fresh", nil
+	}
+	res, _ := fnl.Execute("opId", opExeFunc)
+	assert.Equal(t, "stale", res)
+	time.Sleep(cacheTtl * 2)
+
+	// The stale result is served right away while a single execution refreshes it.
+	for i := 0; i < 10; i++ {
+		res, err := fnl.Execute("opId", opExeFunc)
+		assert.Equal(t, "stale", res)
+		assert.Nil(t, err)
+	}
+	assert.Eventually(t, func() bool { return fnl.IsExecuting("opId") }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&numOfExecutions))
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		res, _ := fnl.Execute("opId", opExeFunc)
+		return res == "fresh"
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&numOfExecutions))
+}
+
+func TestWithStaleWhileRevalidateExpired(t *testing.T) {
+	cacheTtl, staleTime := time.Millisecond*20, time.Millisecond*20
+	fnl := New(WithCacheTtl(cacheTtl), WithStaleWhileRevalidate(staleTime))
+
+	fnl.Execute("opId", func() (interface{}, error) { return "stale", nil })
+	time.Sleep((cacheTtl + staleTime) * 2)
+
+	// Past the stale time the request waits for a fresh execution.
+	res, _ := fnl.Execute("opId", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 10)
+		return "fresh", nil
+	})
+	assert.Equal(t, "fresh", res)
+}
@@ -0,0 +1,29 @@
+package funnel
+
+import "sync/atomic"
+
+// OpState is the scratch space of an operation executed with ExecuteWithState. It persists across the retry attempts of
+// the operation (see WithRetryBackoff), but not across separate operations: a new execution of the same operation
+// identifier (e.g. after its result expired) starts with a new state.
+type OpState struct {
+	// Value is free for the operation's function to carry state from an attempt to the next, e.g. a cursor. The hedged
+	// attempts of an operation (see WithHedging) run concurrently and must synchronize their access to it.
+	Value interface{}
+
+	attempts int32
+}
+
+// Attempt returns the number of the current attempt of the operation, starting at 1.
+func (s *OpState) Attempt() int {
+	return int(atomic.LoadInt32(&s.attempts))
+}
+
+// ExecuteWithState is like Execute, but the operation's function receives the operation's state, which persists
+// across its retry attempts.
+func (f *Funnel) ExecuteWithState(operationId string, opExeFunc func(state *OpState) (interface{}, error)) (res interface{}, err error) {
+	state := &OpState{}
+	return f.Execute(operationId, func() (interface{}, error) {
+		atomic.AddInt32(&state.attempts, 1)
+		return opExeFunc(state)
+	})
+}
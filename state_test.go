@@ -0,0 +1,41 @@
+package funnel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteWithStateAcrossRetries(t *testing.T) {
+	fnl := New(WithRetryBackoff(time.Millisecond, time.Millisecond, 1, 0, time.Second))
+
+	var attempts []int
+	res, err := fnl.ExecuteWithState("op", func(state *OpState) (interface{}, error) {
+		attempts = append(attempts, state.Attempt())
+		if state.Value == nil {
+			state.Value = "cursor"
+			return nil, errors.New("first attempt fails")
+		}
+		return state.Value, nil
+	})
+
+	assert.Equal(t, "cursor", res)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, attempts)
+}
+
+func TestExecuteWithStateNotSharedBetweenOperations(t *testing.T) {
+	fnl := New()
+
+	for i := 0; i < 2; i++ {
+		res, err := fnl.ExecuteWithState("op", func(state *OpState) (interface{}, error) {
+			assert.Nil(t, state.Value)
+			state.Value = i
+			return state.Attempt(), nil
+		})
+		assert.Equal(t, 1, res)
+		assert.Nil(t, err)
+	}
+}
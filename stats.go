@@ -0,0 +1,190 @@
+package funnel
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the buckets of the latency histograms, the last bucket having no upper bound.
+var latencyBounds = []time.Duration{
+	time.Microsecond, time.Microsecond * 10, time.Microsecond * 100,
+	time.Millisecond, time.Millisecond * 10, time.Millisecond * 100, time.Second,
+}
+
+// counters holds the funnel's counters. Its fields are updated atomically.
+type counters struct {
+	timeoutDeletions uint64
+	cleanCompletions uint64
+
+	// The outcomes of the requests and of the executions, see Stats.
+	executions uint64
+	coalesced  uint64
+	cacheHits  uint64
+	timeouts   uint64
+	panics     uint64
+	nearMisses uint64
+
+	// The number of goroutines currently waiting for an operation.
+	waiters int64
+
+	hitLatency  latencyCounters
+	missLatency latencyCounters
+}
+
+// latencyCounters holds the counters of a latency histogram.
+type latencyCounters struct {
+	counts [8]uint64 // One per bound, and one for the latencies above the last bound.
+	sum    int64
+
+	// The exemplar of each bucket, the last latency recorded in it with a trace.
+	exemplars [8]atomic.Pointer[Exemplar]
+}
+
+// record records the latency of a request made with the context, which may be nil, taking the identifiers of its trace
+// from the tracer, if any.
+func (c *latencyCounters) record(ctx context.Context, tracer Tracer, latency time.Duration) {
+	bucket := 0
+	for bucket < len(latencyBounds) && latency > latencyBounds[bucket] {
+		bucket++
+	}
+	atomic.AddUint64(&c.counts[bucket], 1)
+	atomic.AddInt64(&c.sum, int64(latency))
+	if ctx == nil || tracer == nil {
+		return
+	}
+	if traceId, spanId, ok := tracer.TraceIDs(ctx); ok {
+		c.exemplars[bucket].Store(&Exemplar{Latency: latency, TraceId: traceId, SpanId: spanId})
+	}
+}
+
+func (c *latencyCounters) histogram() LatencyHistogram {
+	h := LatencyHistogram{Bounds: latencyBounds, Counts: make([]uint64, len(c.counts)), Exemplars: make([]*Exemplar, len(c.counts))}
+	for i := range c.counts {
+		h.Counts[i] = atomic.LoadUint64(&c.counts[i])
+		h.Count += h.Counts[i]
+		h.Exemplars[i] = c.exemplars[i].Load()
+	}
+	h.Sum = time.Duration(atomic.LoadInt64(&c.sum))
+	return h
+}
+
+// recordLatency records the latency of a request whose result was delivered, made with the context (which may be nil).
+func (c *counters) recordLatency(ctx context.Context, tracer Tracer, hit bool, latency time.Duration) {
+	if hit {
+		c.hitLatency.record(ctx, tracer, latency)
+	} else {
+		c.missLatency.record(ctx, tracer, latency)
+	}
+}
+
+// An Exemplar is a latency recorded in a histogram along with the trace of the request, so that a latency outlier
+// shown by the histogram can be linked to a representative trace, e.g. as an OpenMetrics exemplar of its bucket.
+type Exemplar struct {
+	Latency time.Duration
+
+	// The identifiers of the trace and of the span of the request, as found in its context (see ExecuteContext) by the
+	// tracer (see Tracer.TraceIDs).
+	TraceId string
+	SpanId  string
+}
+
+// LatencyHistogram is a histogram of request latencies.
+type LatencyHistogram struct {
+	// Bounds holds the upper bound of each bucket but the last one, which has no upper bound. The slice is shared, and
+	// must not be modified.
+	Bounds []time.Duration
+
+	// Counts holds the number of latencies in each bucket, one more than the number of bounds.
+	Counts []uint64
+
+	// The number of latencies recorded and their sum.
+	Count uint64
+	Sum   time.Duration
+
+	// Exemplars holds the exemplar of each bucket, the last latency recorded in it for a request with a trace, nil for
+	// the buckets that have none. Only the requests made with a context (see ExecuteContext) may have a trace, and only
+	// with a tracer (see WithTracer).
+	Exemplars []*Exemplar
+}
+
+// Mean returns the mean of the latencies recorded, or 0 when none was recorded.
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Stats is a snapshot of the funnel's counters, as returned by Funnel.Stats.
+type Stats struct {
+	// TimeoutDeletions counts the operations deleted because their callers timed out before the execution completed.
+	// Each of them causes a re-execution of the operation by the next request. A high ratio of TimeoutDeletions to
+	// CleanCompletions signals a timeout too short for the operations, causing wasteful re-executions.
+	TimeoutDeletions uint64
+
+	// CleanCompletions counts the executions that returned (without panic) before their operation was deleted.
+	CleanCompletions uint64
+
+	// Executions counts the requests that started an execution, Coalesced the requests that joined an execution in
+	// process and CacheHits the requests served with a cached result. Timeouts counts the requests that timed out
+	// waiting for an operation, and Panics the executions that panicked.
+	Executions uint64
+	Coalesced  uint64
+	CacheHits  uint64
+	Timeouts   uint64
+	Panics     uint64
+
+	// NearMisses counts the operations re-created within the near-miss grace after the expiry of their cached result,
+	// whose re-execution a slightly longer cache time-to-live would have spared (see WithNearMissGrace).
+	NearMisses uint64
+
+	// HitLatency is the histogram of the latencies of the requests served from the cache, including the copy of the
+	// result (see ExecuteAndCopyResult), and MissLatency the histogram of the latencies of the other requests whose
+	// result was delivered (those that started the execution or joined it while in process). Cache hits should be
+	// near-instant, a regression (e.g. due to lock contention or copying large results) shows in HitLatency.
+	// Promises and GetOrLoadAll are not recorded.
+	HitLatency  LatencyHistogram
+	MissLatency LatencyHistogram
+
+	// InFlight is the number of operations being executed and Cached the number of cached results, as of the snapshot.
+	// TotalKeys is the number of operations held by the funnel, which also counts the operations that ended with panic.
+	InFlight  int
+	Cached    int
+	TotalKeys int
+}
+
+// Stats returns a snapshot of the funnel's counters and of the operations it holds, the latter counted under a single
+// acquisition of the lock.
+func (f *Funnel) Stats() Stats {
+	stats := Stats{
+		TimeoutDeletions: atomic.LoadUint64(&f.counters.timeoutDeletions),
+		CleanCompletions: atomic.LoadUint64(&f.counters.cleanCompletions),
+		Executions:       atomic.LoadUint64(&f.counters.executions),
+		Coalesced:        atomic.LoadUint64(&f.counters.coalesced),
+		CacheHits:        atomic.LoadUint64(&f.counters.cacheHits),
+		Timeouts:         atomic.LoadUint64(&f.counters.timeouts),
+		Panics:           atomic.LoadUint64(&f.counters.panics),
+		NearMisses:       atomic.LoadUint64(&f.counters.nearMisses),
+		HitLatency:       f.counters.hitLatency.histogram(),
+		MissLatency:      f.counters.missLatency.histogram(),
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	now := time.Now()
+	stats.TotalKeys = len(f.opInProcess)
+	for _, op := range f.opInProcess {
+		if op.completed.IsSet() {
+			if op.cacheable && now.Before(op.expiresAt) {
+				stats.Cached++
+			}
+			continue
+		}
+		if op.inProcess() {
+			stats.InFlight++
+		}
+	}
+	return stats
+}
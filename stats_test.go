@@ -0,0 +1,136 @@
+package funnel
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsTimeoutDeletionsAndCleanCompletions(t *testing.T) {
+	fnl := New(WithTimeout(time.Millisecond * 20))
+
+	numOfCompletions, numOfTimeouts := 3, 2
+	for i := 0; i < numOfCompletions; i++ {
+		fnl.Execute("fast"+strconv.Itoa(i), func() (interface{}, error) {
+			return nil, nil
+		})
+	}
+
+	release := make(chan empty)
+	for i := 0; i < numOfTimeouts; i++ {
+		_, err := fnl.Execute("slow"+strconv.Itoa(i), func() (interface{}, error) {
+			<-release
+			return nil, nil
+		})
+		assert.Equal(t, timeoutError, err)
+	}
+	// The executions completing after their operation was deleted are not clean completions.
+	close(release)
+	time.Sleep(time.Millisecond * 20)
+
+	stats := fnl.Stats()
+	assert.Equal(t, uint64(numOfTimeouts), stats.TimeoutDeletions)
+	assert.Equal(t, uint64(numOfCompletions), stats.CleanCompletions)
+}
+
+func TestStatsHitLatency(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Minute))
+
+	fnl.Execute("op", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 10)
+		return 1, nil
+	})
+	numOfHits := 5
+	for i := 0; i < numOfHits; i++ {
+		res, err := fnl.Execute("op", func() (interface{}, error) {
+			t.Error("a cache hit must not execute the operation")
+			return nil, nil
+		})
+		assert.Equal(t, 1, res)
+		assert.Nil(t, err)
+	}
+
+	stats := fnl.Stats()
+	assert.Equal(t, uint64(numOfHits), stats.HitLatency.Count)
+	assert.Equal(t, uint64(1), stats.MissLatency.Count)
+	assert.Len(t, stats.HitLatency.Counts, len(stats.HitLatency.Bounds)+1)
+	assert.GreaterOrEqual(t, stats.MissLatency.Mean(), time.Millisecond*10)
+	assert.Less(t, stats.HitLatency.Mean()*10, stats.MissLatency.Mean())
+}
+
+func TestStatsInFlightAndCached(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour))
+	fnl.Execute("cached", func() (interface{}, error) { return nil, nil })
+	assert.Panics(t, func() {
+		fnl.Execute("panicked", func() (interface{}, error) { panic("test ends with panic") })
+	})
+
+	release := make(chan empty)
+	defer close(release)
+	go fnl.Execute("in-flight", func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	assert.Eventually(t, func() bool { return fnl.IsExecuting("in-flight") }, time.Second, time.Millisecond)
+
+	stats := fnl.Stats()
+	assert.Equal(t, 1, stats.InFlight)
+	assert.Equal(t, 1, stats.Cached)
+	assert.Equal(t, 3, stats.TotalKeys)
+}
+
+func TestStatsLatencyExemplars(t *testing.T) {
+	tracer := &recordingTracer{outcomes: map[string]Outcome{}, requests: map[string][]bool{}}
+	fnl := New(WithCacheTtl(time.Minute), WithTracer(tracer))
+
+	ctx := context.WithValue(context.Background(), traceKey{}, [2]string{"trace", "span"})
+	fnl.ExecuteContext(ctx, "op", func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Millisecond * 20)
+		return 1, nil
+	})
+	fnl.ExecuteContext(context.Background(), "untraced context", func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Millisecond * 20)
+		return 1, nil
+	})
+	fnl.Execute("untraced", func() (interface{}, error) { return 1, nil })
+
+	var exemplars []*Exemplar
+	for _, exemplar := range fnl.Stats().MissLatency.Exemplars {
+		if exemplar != nil {
+			exemplars = append(exemplars, exemplar)
+		}
+	}
+	if assert.Len(t, exemplars, 1, "only the traced request has an exemplar") {
+		assert.Equal(t, "trace", exemplars[0].TraceId)
+		assert.Equal(t, "span", exemplars[0].SpanId)
+		assert.GreaterOrEqual(t, exemplars[0].Latency, time.Millisecond*20)
+	}
+}
+
+func TestStatsNearMisses(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Millisecond*20), WithNearMissGrace(time.Millisecond*100))
+	opExeFunc := func() (interface{}, error) { return nil, nil }
+
+	fnl.Execute("soon", opExeFunc)
+	fnl.Execute("late", opExeFunc)
+	time.Sleep(time.Millisecond * 40)
+	fnl.Execute("soon", opExeFunc)
+	assert.Equal(t, uint64(1), fnl.Stats().NearMisses, "re-created within the grace after its expiry")
+
+	time.Sleep(time.Millisecond * 150)
+	fnl.Execute("late", opExeFunc)
+	assert.Equal(t, uint64(1), fnl.Stats().NearMisses, "re-created long after its expiry")
+
+	// A forgotten operation didn't expire.
+	fnl.Execute("forgotten", opExeFunc)
+	fnl.Forget("forgotten")
+	fnl.Execute("forgotten", opExeFunc)
+	assert.Equal(t, uint64(1), fnl.Stats().NearMisses)
+
+	fnl.Lock()
+	defer fnl.Unlock()
+	assert.NotContains(t, fnl.expired.graceEnds, "late")
+}
@@ -0,0 +1,54 @@
+package funnel
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSynchronous(t *testing.T) {
+	fnl := New(WithCacheTtl(time.Hour), WithSynchronous(true))
+
+	numOfExecutions := 0 // Not synchronized, the executions run on the test's goroutine.
+	opExeFunc := func() (interface{}, error) {
+		numOfExecutions++
+		assert.True(t, strings.Contains(string(debug.Stack()), "TestWithSynchronous("), "should execute on the caller's goroutine")
+		return numOfExecutions, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		res, err := fnl.Execute("opId", opExeFunc)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, res)
+	}
+	assert.Equal(t, 1, numOfExecutions)
+
+	assert.Panics(t, func() {
+		fnl.Execute("panic", func() (interface{}, error) {
+			panic("test ends with panic")
+		})
+	})
+}
+
+func benchmarkSerialExecute(b *testing.B, synchronous bool) {
+	fnl := New(WithSynchronous(synchronous))
+	opExeFunc := func() (interface{}, error) {
+		return nil, nil
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fnl.Execute("opId", opExeFunc)
+	}
+}
+
+func BenchmarkSerialExecute(b *testing.B) {
+	benchmarkSerialExecute(b, false)
+}
+
+func BenchmarkSerialExecuteSynchronous(b *testing.B) {
+	benchmarkSerialExecute(b, true)
+}
@@ -0,0 +1,106 @@
+package funnel
+
+import (
+	"context"
+	"time"
+)
+
+// A Tracer traces the executions of the operations and the requests for them, e.g. as the spans of a distributed
+// trace (see WithTracer, and the funnelotel package for an OpenTelemetry adapter). The methods are called without
+// holding the funnel's lock, so they must be safe for concurrent use and should return quickly.
+type Tracer interface {
+	// StartExecution is called by the goroutine executing the operation before the execution, with the context of the
+	// execution (see ExecuteContext) or of the request that started it, and returns the span of the execution, ended
+	// once the execution completed, and the context carrying it, derived from the given one: the function of the
+	// operation receives it if it takes a context.
+	StartExecution(ctx context.Context, operationId string) (context.Context, ExecutionSpan)
+
+	// Requested is called for each request that started an execution of the operation, as its leader, or joined an
+	// execution in process, with the context of the request. It's not called for the requests served from the cache.
+	Requested(ctx context.Context, operationId string, leader bool)
+
+	// TraceIDs returns the identifiers of the trace and of the span found in the context of a request, false when the
+	// context has none. They're recorded with the latencies of the requests as exemplars, see LatencyHistogram.
+	TraceIDs(ctx context.Context) (traceId, spanId string, ok bool)
+}
+
+// An ExecutionSpan is the span of an execution of an operation, see Tracer.
+type ExecutionSpan interface {
+	// End ends the span with the outcome of the execution, and its error if any: the error returned by the function,
+	// or an error describing the panic.
+	End(outcome Outcome, err error)
+}
+
+// An Outcome is the outcome of an execution of an operation, see ExecutionSpan.
+type Outcome int
+
+const (
+	// OutcomeSuccess is the outcome of an execution that returned without an error.
+	OutcomeSuccess Outcome = iota
+
+	// OutcomeError is the outcome of an execution that returned an error.
+	OutcomeError
+
+	// OutcomeTimeout is the outcome of an execution that returned after the timeout (see WithTimeout), whose result
+	// the waiting goroutines didn't receive.
+	OutcomeTimeout
+
+	// OutcomePanic is the outcome of an execution that panicked.
+	OutcomePanic
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeSuccess:
+		return "success"
+	case OutcomeError:
+		return "error"
+	case OutcomeTimeout:
+		return "timeout"
+	case OutcomePanic:
+		return "panic"
+	}
+	return "unknown"
+}
+
+// startSpan starts the span of the execution of the operation, if the funnel has a tracer, and hands the context
+// carrying it to the request's function.
+func (op *operationInProcess) startSpan(call callConfig) {
+	tracer := op.config.tracer
+	if tracer == nil {
+		return
+	}
+
+	// The context of the execution rather than the request's, so that the request giving up doesn't cancel it.
+	ctx := op.execCtx
+	if ctx == nil {
+		ctx = call.waitContext()
+	}
+	ctx, op.span = tracer.StartExecution(ctx, op.operationId)
+	if call.spanCtx != nil {
+		*call.spanCtx = ctx
+	}
+}
+
+// endSpan returns the notification ending the span of the execution of the operation with its outcome, given the value
+// recovered from its panic if any, or nil without a span.
+func (op *operationInProcess) endSpan(recovered interface{}) func() {
+	if op.span == nil {
+		return nil
+	}
+	span, outcome, err := op.span, OutcomeSuccess, op.err
+	switch {
+	case recovered != nil:
+		outcome = OutcomePanic
+	case time.Since(op.startTime) >= op.config.timeout:
+		outcome = OutcomeTimeout
+	case err != nil:
+		outcome = OutcomeError
+	}
+	return func() {
+		if recovered != nil {
+			err = op.panicError(recovered) // Once the notification is made, the stack of the panic is captured.
+		}
+		span.End(outcome, err)
+	}
+}
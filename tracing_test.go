@@ -0,0 +1,113 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingTracer records the outcome of each execution and the requests by operation identifier.
+type recordingTracer struct {
+	sync.Mutex
+	outcomes map[string]Outcome
+	requests map[string][]bool
+}
+
+type recordingSpan struct {
+	t           *recordingTracer
+	operationId string
+}
+
+// executionKey is the key of the identifier of the operation in the contexts of the executions traced by recordingTracer.
+type executionKey struct{}
+
+func (t *recordingTracer) StartExecution(ctx context.Context, operationId string) (context.Context, ExecutionSpan) {
+	return context.WithValue(ctx, executionKey{}, operationId), recordingSpan{t: t, operationId: operationId}
+}
+
+func (t *recordingTracer) Requested(ctx context.Context, operationId string, leader bool) {
+	t.Lock()
+	defer t.Unlock()
+	t.requests[operationId] = append(t.requests[operationId], leader)
+}
+
+// traceKey is the key of the identifiers of the trace and of the span in the contexts traced by recordingTracer.
+type traceKey struct{}
+
+func (t *recordingTracer) TraceIDs(ctx context.Context) (traceId, spanId string, ok bool) {
+	ids, ok := ctx.Value(traceKey{}).([2]string)
+	return ids[0], ids[1], ok
+}
+
+func (s recordingSpan) End(outcome Outcome, err error) {
+	s.t.Lock()
+	defer s.t.Unlock()
+	s.t.outcomes[s.operationId] = outcome
+}
+
+func (t *recordingTracer) outcome(operationId string) (Outcome, bool) {
+	t.Lock()
+	defer t.Unlock()
+	outcome, found := t.outcomes[operationId]
+	return outcome, found
+}
+
+func TestWithTracer(t *testing.T) {
+	tracer := &recordingTracer{outcomes: map[string]Outcome{}, requests: map[string][]bool{}}
+	fnl := New(WithCacheTtl(time.Hour), WithTimeout(time.Millisecond*20), WithTracer(tracer))
+
+	fnl.Execute("success", func() (interface{}, error) { return nil, nil })
+	fnl.Execute("success", nil)
+	fnl.Execute("error", func() (interface{}, error) { return nil, errors.New("failed") })
+	fnl.Execute("timeout", func() (interface{}, error) {
+		time.Sleep(time.Millisecond * 50)
+		return nil, nil
+	})
+	assert.Panics(t, func() {
+		fnl.Execute("panic", func() (interface{}, error) { panic("test ends with panic") })
+	})
+
+	expected := map[string]Outcome{"success": OutcomeSuccess, "error": OutcomeError, "timeout": OutcomeTimeout, "panic": OutcomePanic}
+	for operationId, outcome := range expected {
+		assert.Eventually(t, func() bool {
+			recorded, found := tracer.outcome(operationId)
+			return found && recorded == outcome
+		}, time.Second, time.Millisecond, operationId)
+	}
+
+	// A request served from the cache is not traced.
+	tracer.Lock()
+	defer tracer.Unlock()
+	assert.Equal(t, []bool{true}, tracer.requests["success"])
+}
+
+func TestTracerExecutionContext(t *testing.T) {
+	tracer := &recordingTracer{outcomes: map[string]Outcome{}, requests: map[string][]bool{}}
+	fnl := New(WithTracer(tracer))
+
+	res, err := fnl.ExecuteContext(context.Background(), "opId", func(ctx context.Context) (interface{}, error) {
+		return ctx.Value(executionKey{}), nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "opId", res, "the execution should receive the context returned by the tracer")
+
+	// The context returned by the tracer is still canceled with the operation.
+	executing := make(chan empty)
+	go func() {
+		fnl.ExecuteContext(context.Background(), "canceled", func(ctx context.Context) (interface{}, error) {
+			close(executing)
+			<-ctx.Done()
+			return nil, context.Cause(ctx)
+		})
+	}()
+	<-executing
+	assert.True(t, fnl.Cancel("canceled", errors.New("canceled")))
+	assert.Eventually(t, func() bool {
+		outcome, found := tracer.outcome("canceled")
+		return found && outcome == OutcomeError
+	}, time.Second, time.Millisecond)
+}
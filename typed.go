@@ -0,0 +1,76 @@
+package funnel
+
+import "fmt"
+
+// TypedFunnel is a type-safe wrapper of a Funnel, whose operations are identified by keys of type K and return results
+// of type V, sparing the callers the type assertions of the results.
+type TypedFunnel[K comparable, V any] struct {
+	f *Funnel
+}
+
+// NewTyped returns a TypedFunnel wrapping a new Funnel created with the options, see New.
+func NewTyped[K comparable, V any](option ...Option) *TypedFunnel[K, V] {
+	return &TypedFunnel[K, V]{f: New(option...)}
+}
+
+// Funnel returns the wrapped funnel, e.g. for its statistics. Its operations are identified by the keys formatted as by
+// TypedKey.
+func (t *TypedFunnel[K, V]) Funnel() *Funnel {
+	return t.f
+}
+
+// Execute is like Funnel.Execute. The result is the zero value of V when the operation returned no result (e.g. timed out).
+func (t *TypedFunnel[K, V]) Execute(key K, opExeFunc func() (V, error), options ...CallOption) (V, error) {
+	res, err := t.f.Execute(TypedKey(key), untyped(opExeFunc), options...)
+	return typed[V](res), err
+}
+
+// ExecuteAndCopyResult is like Funnel.ExecuteAndCopyResult, the copy being of type V as well.
+func (t *TypedFunnel[K, V]) ExecuteAndCopyResult(key K, opExeFunc func() (V, error)) (V, error) {
+	res, err := t.f.ExecuteAndCopyResult(TypedKey(key), untyped(opExeFunc))
+	return typed[V](res), err
+}
+
+// Forget is like Funnel.Forget.
+func (t *TypedFunnel[K, V]) Forget(key K) {
+	t.f.Forget(TypedKey(key))
+}
+
+// IsOpInProgress is like Funnel.IsOpInProgress.
+func (t *TypedFunnel[K, V]) IsOpInProgress(key K) bool {
+	return t.f.IsOpInProgress(TypedKey(key))
+}
+
+// IsExecuting is like Funnel.IsExecuting.
+func (t *TypedFunnel[K, V]) IsExecuting(key K) bool {
+	return t.f.IsExecuting(TypedKey(key))
+}
+
+// TypedKey returns the operation identifier of a TypedFunnel's key: with string keys the key is the identifier itself,
+// and other keys are formatted with their Go syntax (the %#v verb), so that keys of any comparable type, such as structs,
+// are supported. With keys of an interface type (e.g. any), the keys are prefixed with their dynamic type, so that keys
+// of different types such as "1", 1 and int64(1) are told apart.
+// Keys implementing fmt.GoStringer are formatted by their GoString method, which must tell unequal keys apart.
+func TypedKey[K comparable](key K) string {
+	var zero K
+	switch any(zero).(type) {
+	case string:
+		return any(key).(string)
+	case nil: // The zero value of an interface type.
+		return fmt.Sprintf("%T:%#v", key, key)
+	}
+	return fmt.Sprintf("%#v", key)
+}
+
+// untyped adapts the function of a typed operation to the funnel.
+func untyped[V any](opExeFunc func() (V, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		return opExeFunc()
+	}
+}
+
+// typed returns the result of a typed operation, or the zero value of V for no result.
+func typed[V any](res interface{}) V {
+	v, _ := res.(V)
+	return v
+}
@@ -0,0 +1,99 @@
+package funnel
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type typedSample struct {
+	Value int
+}
+
+func TestTypedFunnel(t *testing.T) {
+	fnl := NewTyped[int, *typedSample](WithCacheTtl(time.Minute))
+
+	numOfExecutions := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := fnl.Execute(1, func() (*typedSample, error) {
+				time.Sleep(time.Millisecond * 10)
+				numOfExecutions++
+				return &typedSample{Value: 1}, nil
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, 1, res.Value)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, numOfExecutions)
+	assert.True(t, fnl.IsOpInProgress(1))
+	assert.False(t, fnl.IsOpInProgress(2))
+
+	// An operation without a result returns the zero value.
+	res, err := fnl.Execute(2, func() (*typedSample, error) {
+		return nil, errors.New("failed")
+	})
+	assert.Nil(t, res)
+	assert.EqualError(t, err, "failed")
+
+	fnl.Forget(1)
+	assert.False(t, fnl.IsOpInProgress(1))
+}
+
+func TestTypedFunnelStructKeys(t *testing.T) {
+	type key struct {
+		Id   string
+		Page int
+	}
+	fnl := NewTyped[key, int](WithCacheTtl(time.Minute))
+
+	for page := 0; page < 3; page++ {
+		res, err := fnl.Execute(key{"id", page}, func() (int, error) {
+			return page, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, page, res)
+	}
+	assert.Equal(t, 3, fnl.Funnel().Dump().Operations)
+	assert.True(t, fnl.IsOpInProgress(key{"id", 1}))
+	assert.NotEqual(t, TypedKey(key{"id", 1}), TypedKey(key{"id", 2}))
+}
+
+func TestTypedFunnelExecuteAndCopyResult(t *testing.T) {
+	fnl := NewTyped[string, *typedSample](WithCacheTtl(time.Minute))
+	opExeFunc := func() (*typedSample, error) {
+		return &typedSample{Value: 1}, nil
+	}
+
+	first, err := fnl.ExecuteAndCopyResult("opId", opExeFunc)
+	assert.Nil(t, err)
+	first.Value = 2
+
+	second, err := fnl.ExecuteAndCopyResult("opId", opExeFunc)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, second.Value)
+	assert.Equal(t, "opId", TypedKey("opId"))
+}
+
+func TestTypedKeyInterface(t *testing.T) {
+	keys := []any{"1", 1, int64(1), nil}
+	ids := map[string]empty{}
+	for _, key := range keys {
+		ids[TypedKey(key)] = empty{}
+	}
+	assert.Len(t, ids, len(keys), "keys of different types should not collide")
+
+	fnl := NewTyped[any, string](WithCacheTtl(time.Minute))
+	for _, key := range keys {
+		res, _ := fnl.Execute(key, func() (string, error) { return fmt.Sprint(key), nil })
+		assert.Equal(t, fmt.Sprint(key), res)
+	}
+}
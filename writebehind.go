@@ -0,0 +1,84 @@
+package funnel
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// writeBehindWorkers is the maximum number of goroutines writing results behind concurrently.
+	writeBehindWorkers = 4
+
+	// writeBehindQueue is the maximum number of results waiting to be written behind, beyond which results are dropped.
+	writeBehindQueue = 1024
+)
+
+// writeBehindEntry is a cached result to write behind.
+type writeBehindEntry struct {
+	write       func(operationId string, res interface{}, err error, ttl time.Duration)
+	operationId string
+	opResult
+	ttl time.Duration
+}
+
+// writeBehind writes the cached results behind with a bounded pool of workers, see WithWriteBehind. The workers are
+// started as results are queued, and exit once the queue is empty.
+type writeBehind struct {
+	queue   chan writeBehindEntry
+	workers chan empty
+}
+
+func newWriteBehind() *writeBehind {
+	return &writeBehind{
+		queue:   make(chan writeBehindEntry, writeBehindQueue),
+		workers: make(chan empty, writeBehindWorkers),
+	}
+}
+
+// enqueueWriteBehind queues the result for writing, and starts a worker unless all of them are already busy.
+func (f *Funnel) enqueueWriteBehind(entry writeBehindEntry) {
+	select {
+	case f.writeBehind.queue <- entry:
+	default:
+		f.internalError(entry.operationId, fmt.Errorf("write-behind of operation %s dropped, %d results are queued", entry.operationId, writeBehindQueue))
+		return
+	}
+
+	select {
+	case f.writeBehind.workers <- empty{}:
+		go f.writeBehindWorker()
+	default:
+	}
+}
+
+// writeBehindWorker writes the queued results until the queue is empty.
+func (f *Funnel) writeBehindWorker() {
+	for {
+		select {
+		case entry := <-f.writeBehind.queue:
+			f.writeBehindResult(entry)
+		default:
+			<-f.writeBehind.workers
+
+			// A result queued after the queue was found empty, while this worker still took its place, is written now.
+			if len(f.writeBehind.queue) == 0 {
+				return
+			}
+			select {
+			case f.writeBehind.workers <- empty{}:
+			default:
+				return
+			}
+		}
+	}
+}
+
+// writeBehindResult writes a result, reporting the panic of the write function to the internal error handler.
+func (f *Funnel) writeBehindResult(entry writeBehindEntry) {
+	defer func() {
+		if rr := recover(); rr != nil {
+			f.internalError(entry.operationId, fmt.Errorf("write-behind of operation %s panicked: %v", entry.operationId, rr))
+		}
+	}()
+	entry.write(entry.operationId, entry.res, entry.err, entry.ttl)
+}
@@ -0,0 +1,116 @@
+package funnel
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithWriteBehind(t *testing.T) {
+	var mutex sync.Mutex
+	written := map[string]int{}
+	fnl := New(WithCacheTtl(time.Minute), WithShouldCachePredicate(func(res interface{}, err error) bool {
+		return res != "not cached"
+	}), WithWriteBehind(func(operationId string, res interface{}, err error, ttl time.Duration) {
+		assert.Equal(t, "res", res)
+		assert.Equal(t, time.Minute, ttl)
+		mutex.Lock()
+		written[operationId]++
+		mutex.Unlock()
+	}))
+
+	numOfOps := 100
+	for i := 0; i < numOfOps; i++ {
+		for j := 0; j < 3; j++ {
+			fnl.Execute(strconv.Itoa(i), func() (interface{}, error) {
+				return "res", nil
+			})
+		}
+	}
+	fnl.Execute("uncached", func() (interface{}, error) {
+		return "not cached", nil
+	})
+
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(written) == numOfOps
+	}, time.Second, time.Millisecond)
+	time.Sleep(time.Millisecond * 10)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for id, numOfWrites := range written {
+		assert.Equal(t, 1, numOfWrites, id)
+	}
+}
+
+func TestWithWriteBehindPanic(t *testing.T) {
+	reported := make(chan error, 1)
+	fnl := New(WithCacheTtl(time.Minute), WithWriteBehind(func(operationId string, res interface{}, err error, ttl time.Duration) {
+		panic("external cache unavailable")
+	}), WithOnInternalError(func(operationId string, err error) {
+		reported <- err
+	}))
+
+	res, err := fnl.Execute("opId", func() (interface{}, error) {
+		return nil, errors.New("cached error")
+	})
+	assert.Nil(t, res)
+	assert.EqualError(t, err, "cached error")
+	assert.Contains(t, (<-reported).Error(), "external cache unavailable")
+}
+
+func TestWithReadThrough(t *testing.T) {
+	external := map[string]interface{}{"remote": "external result"}
+	var mutex sync.Mutex
+	numOfReads := 0
+	written := make(chan string, 2)
+	fnl := New(WithCacheTtl(time.Minute), WithReadThrough(func(operationId string) (interface{}, error, bool) {
+		mutex.Lock()
+		numOfReads++
+		mutex.Unlock()
+		res, ok := external[operationId]
+		return res, nil, ok
+	}), WithWriteBehind(func(operationId string, res interface{}, err error, ttl time.Duration) {
+		written <- operationId
+	}))
+
+	// Concurrent requests for the same operation share a single lookup, whose hit avoids the execution.
+	release := make(chan empty)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-release
+			res, err := fnl.Execute("remote", func() (interface{}, error) {
+				t.Error("a read through hit must not execute the operation")
+				return nil, nil
+			})
+			assert.Equal(t, "external result", res)
+			assert.Nil(t, err)
+		}()
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 1, numOfReads)
+
+	// The result is cached locally.
+	res, _ := fnl.Execute("remote", nil)
+	assert.Equal(t, "external result", res)
+	assert.Equal(t, 1, numOfReads)
+
+	// A miss executes the operation, whose result is written behind.
+	res, _ = fnl.Execute("local", func() (interface{}, error) {
+		return "local result", nil
+	})
+	assert.Equal(t, "local result", res)
+	assert.Equal(t, "local", <-written)
+	assert.Equal(t, 2, numOfReads)
+	assert.Empty(t, written)
+}